@@ -2,4 +2,7 @@ module github.com/wejick/vektor
 
 go 1.24.1
 
-require github.com/kshard/fvecs v0.0.2 // indirect
+require (
+	github.com/kshard/fvecs v0.0.2
+	golang.org/x/sys v0.40.0
+)
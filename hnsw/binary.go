@@ -0,0 +1,88 @@
+package hnsw
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// binaryQuantizer is the quantizer of QuantizationBinary. Every dimension is stored as its sign bit,
+// packed into 64 bit little endian words, and the distance is the Hamming distance between the bits.
+// It only needs the sign, so there is nothing to train
+type binaryQuantizer struct {
+	vectorDim int
+}
+
+func newBinaryQuantizer(vectorDim int) *binaryQuantizer {
+	return &binaryQuantizer{vectorDim: vectorDim}
+}
+
+func (q *binaryQuantizer) train(samples [][]float32) error {
+	return nil
+}
+
+func (q *binaryQuantizer) trained() bool {
+	return true
+}
+
+func (q *binaryQuantizer) validate() error {
+	return nil
+}
+
+// codeSize round the bits up to 64 bits words
+func (q *binaryQuantizer) codeSize() int {
+	return (q.vectorDim + 63) / 64 * 8
+}
+
+// encode set the bit of every positive dimension
+func (q *binaryQuantizer) encode(vector []float32) []byte {
+	words := make([]uint64, (q.vectorDim+63)/64)
+	for i, value := range vector {
+		if value > 0 {
+			words[i/64] |= 1 << (i % 64)
+		}
+	}
+
+	code := make([]byte, 0, q.codeSize())
+	for _, word := range words {
+		code = binary.LittleEndian.AppendUint64(code, word)
+	}
+
+	return code
+}
+
+func (q *binaryQuantizer) decode(code []byte) []float32 {
+	return q.decodeInto(code, make([]float32, q.vectorDim))
+}
+
+// decodeInto map set bit to 1 and the others to -1
+func (q *binaryQuantizer) decodeInto(code []byte, vector []float32) []float32 {
+	for i := range vector {
+		vector[i] = -1
+		if code[i/8]&(1<<(i%8)) != 0 {
+			vector[i] = 1
+		}
+	}
+
+	return vector
+}
+
+func (q *binaryQuantizer) queryDistance(query []float32) codeDistance {
+	return hammingDistance(q.encode(query))
+}
+
+func (q *binaryQuantizer) nodeDistance(code []byte) codeDistance {
+	return hammingDistance(code)
+}
+
+// hammingDistance is the number of different bits with the code, 64 bits at a time
+type hammingDistance []byte
+
+func (d hammingDistance) distance(code []byte) float32 {
+	var count int
+	code = code[:len(d)]
+	for i := 0; i < len(d); i += 8 {
+		count += bits.OnesCount64(binary.LittleEndian.Uint64(d[i:]) ^ binary.LittleEndian.Uint64(code[i:]))
+	}
+
+	return float32(count)
+}
@@ -0,0 +1,141 @@
+package hnsw
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBinaryQuantizer(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	randomVector := func(dim int) []float32 {
+		vector := make([]float32, dim)
+		for i := range vector {
+			vector[i] = float32(rng.NormFloat64())
+		}
+		return vector
+	}
+
+	// across the 64 bit word boundary
+	for _, dim := range []int{1, 63, 64, 65, 130} {
+		q := newBinaryQuantizer(dim)
+		vec1, vec2 := randomVector(dim), randomVector(dim)
+		code1, code2 := q.encode(vec1), q.encode(vec2)
+
+		if len(code1)%8 != 0 || len(code1)*8 < dim {
+			t.Errorf("dim %d: code of %d bytes", dim, len(code1))
+		}
+
+		var expected float32
+		for i := range vec1 {
+			if (vec1[i] > 0) != (vec2[i] > 0) {
+				expected++
+			}
+		}
+		if got := q.queryDistance(vec1).distance(code2); got != expected {
+			t.Errorf("dim %d: expected hamming %v, got %v", dim, expected, got)
+		}
+		if got := q.nodeDistance(code1).distance(code2); got != expected {
+			t.Errorf("dim %d: expected node hamming %v, got %v", dim, expected, got)
+		}
+
+		for i, value := range q.decode(code1) {
+			if (value > 0) != (vec1[i] > 0) || abs(value) != 1 {
+				t.Errorf("dim %d: dimension %d of %v decoded to %v", dim, i, vec1[i], value)
+			}
+		}
+	}
+}
+
+func TestHNSW_Binary(t *testing.T) {
+	const dim = 256
+
+	// like embeddings, a low dimension latent vector projected to dim,
+	// isotropic noise has no neighbor structure for the sign bits to keep
+	const latentDim = 16
+	rng := rand.New(rand.NewSource(23))
+	projection := make([][]float64, latentDim)
+	for i := range projection {
+		projection[i] = make([]float64, dim)
+		for j := range projection[i] {
+			projection[i][j] = rng.NormFloat64()
+		}
+	}
+	embeddingVectors := func(n int) [][]float32 {
+		vectors := make([][]float32, n)
+		for i := range vectors {
+			vectors[i] = make([]float32, dim)
+			for _, row := range projection {
+				latent := rng.NormFloat64()
+				for j := range vectors[i] {
+					vectors[i][j] += float32(latent * row[j])
+				}
+			}
+		}
+		return vectors
+	}
+	vectors := embeddingVectors(2000)
+	queries := embeddingVectors(50)
+
+	newIndex := func(rerankFactor int) (*HNSW, []int) {
+		h := NewHNSW(HNSWOption{
+			M:                16,
+			EfConstruction:   100,
+			EfSearch:         50,
+			VectorDim:        dim,
+			DistanceComputer: &CosineDistance{},
+			Quantization:     QuantizationBinary,
+			RerankFactor:     rerankFactor,
+
+			RNG: rand.New(rand.NewSource(24)),
+		})
+		// nothing to train
+		ids, err := h.AddVectors(vectors, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h, ids
+	}
+
+	h, ids := newIndex(0)
+	if size := len(h.codes.get(0)); size != dim/8 {
+		t.Errorf("expected %d bytes code, got %d", dim/8, size)
+	}
+	recall := recallAt(h, vectors, ids, queries, 10)
+
+	oversampled, oversampledIDs := newIndex(10)
+	oversampledRecall := recallAt(oversampled, vectors, oversampledIDs, queries, 10)
+	if oversampledRecall <= recall || oversampledRecall < 0.95 {
+		t.Errorf("expected oversampling to improve recall@10 %v, got %v", recall, oversampledRecall)
+	}
+
+	// the radius is in cosine distance, not in hamming distance of the codes
+	if _, _, err := h.SearchRadius(queries[0], 0.5, 0); err == nil {
+		t.Error("expected error searching radius without the vectors")
+	}
+	nearestIDs, nearestDistances, _ := oversampled.Search(queries[0], 5)
+	radiusIDs, radiusDistances, err := oversampled.SearchRadius(queries[0], nearestDistances[4], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(radiusIDs, nearestIDs) || !slices.Equal(radiusDistances, nearestDistances) {
+		t.Errorf("expected the 5 nearest within their radius\n%v %v\n%v %v", nearestIDs, nearestDistances, radiusIDs, radiusDistances)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := oversampled.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries[:10] {
+		expectedIDs, expectedDistances, _ := oversampled.Search(query, 10)
+		gotIDs, gotDistances, _ := loaded.Search(query, 10)
+		if !slices.Equal(expectedIDs, gotIDs) || !slices.Equal(expectedDistances, gotDistances) {
+			t.Fatalf("search differs after loading\n%v %v\n%v %v", expectedIDs, expectedDistances, gotIDs, gotDistances)
+		}
+	}
+}
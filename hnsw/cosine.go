@@ -0,0 +1,39 @@
+package hnsw
+
+import (
+	"math"
+)
+
+const CosineDistanceName = "CosineDistance"
+const InnerProductDistanceName = "InnerProductDistance"
+
+type (
+	CosineDistance       struct{}
+	InnerProductDistance struct{}
+)
+
+// CosineDistance calculates 1 - cosine similarity, from 0 for the same direction to 2 for the opposite.
+// Zero vector has no direction, its distance to anything is 1.
+// With HNSWOption.NormalizeVector InnerProductDistance gives the same order without computing the norms
+func (c *CosineDistance) CalcDistance(vec1, vec2 []float32) float32 {
+	dot, norm1, norm2 := cosineKernel(vec1, vec2)
+	if norm1 == 0 || norm2 == 0 {
+		return 1
+	}
+
+	return 1 - dot/float32(math.Sqrt(float64(norm1))*math.Sqrt(float64(norm2)))
+}
+
+func (c *CosineDistance) GetName() string {
+	return CosineDistanceName
+}
+
+// InnerProductDistance calculates the negated dot product, so the largest dot product is the nearest.
+// It's not a metric, the distance can be negative
+func (ip *InnerProductDistance) CalcDistance(vec1, vec2 []float32) (distance float32) {
+	return -dotKernel(vec1, vec2)
+}
+
+func (ip *InnerProductDistance) GetName() string {
+	return InnerProductDistanceName
+}
@@ -0,0 +1,41 @@
+package hnsw
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCosineDistance(t *testing.T) {
+	cosine := &CosineDistance{}
+
+	tests := []struct {
+		vec1, vec2 []float32
+		expected   float32
+	}{
+		{[]float32{1, 0}, []float32{3, 0}, 0},
+		{[]float32{1, 0}, []float32{0, 2}, 1},
+		{[]float32{1, 0}, []float32{-1, 0}, 2},
+		{[]float32{1, 1}, []float32{1, 0}, 1 - float32(1/math.Sqrt2)},
+		{[]float32{0, 0}, []float32{1, 0}, 1},
+	}
+
+	for _, test := range tests {
+		got := cosine.CalcDistance(test.vec1, test.vec2)
+		if math.Abs(float64(got-test.expected)) > 1e-6 {
+			t.Errorf("CalcDistance(%v, %v): expected %f, got %f", test.vec1, test.vec2, test.expected, got)
+		}
+	}
+}
+
+func TestInnerProductDistance(t *testing.T) {
+	ip := &InnerProductDistance{}
+
+	if got := ip.CalcDistance([]float32{1, 2, 3}, []float32{4, -5, 6}); got != -12 {
+		t.Errorf("expected -12, got %f", got)
+	}
+
+	// larger dot product is nearer
+	if ip.CalcDistance([]float32{1, 1}, []float32{2, 2}) >= ip.CalcDistance([]float32{1, 1}, []float32{1, 1}) {
+		t.Errorf("expected larger dot product to be nearer")
+	}
+}
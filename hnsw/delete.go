@@ -0,0 +1,123 @@
+package hnsw
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Delete mark the node as deleted so it won't be returned by Search.
+// The node is unlinked from every level and its former neighbors are reconnected,
+// so the graph stays navigable. The ID is never reused.
+func (h *GenericHNSW[T]) Delete(id int) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// AddVectors may not have linked the node yet
+	if id < 0 || id >= h.nodes.len() || !h.node(id).linked {
+		return fmt.Errorf("Delete : node %d not found", id)
+	}
+
+	node := h.node(id)
+	if node.Deleted {
+		return fmt.Errorf("Delete : node %d already deleted", id)
+	}
+	h.buildInLinks()
+
+	node.Deleted = true
+	h.deletedCount++
+
+	for level := 0; level <= node.MaxLevel; level++ {
+		h.repairNeighbors(id, level, true)
+		h.setNeighbors(node, level, []int32{})
+	}
+
+	if entryPoint, _ := h.getEntryPoint(); entryPoint == id {
+		h.replaceEntryPoint()
+	}
+
+	return nil
+}
+
+// Len return the number of nodes that are not deleted
+func (h *GenericHNSW[T]) Len() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.nodes.len() - h.deletedCount
+}
+
+// repairNeighbors rebuild every neighbor list on the level that contains the target node, found by its inLinks.
+// the new neighbors are selected from the current neighbors and the neighbors of the target node,
+// when drop is true the target node itself is removed from the candidates
+func (h *GenericHNSW[T]) repairNeighbors(target int, level int, drop bool) {
+	targetNeighbors := h.neighbors(target, level)
+
+	for _, id := range h.linkedFrom(target, level) {
+		node := h.node(int(id))
+
+		nodeDistance := h.distanceFromNode(node.ID)
+		seen := map[int]bool{node.ID: true, target: drop}
+		candidates := make([]pqItem, 0, len(node.PerLevelNeighbors[level])+len(targetNeighbors))
+
+		addCandidates := func(neighbors []int32) {
+			for _, neighbor := range neighbors {
+				neighborID := int(neighbor)
+				if seen[neighborID] || h.node(neighborID).Deleted {
+					continue
+				}
+				seen[neighborID] = true
+
+				distance := nodeDistance.distance(neighborID)
+				candidates = append(candidates, pqItem{Value: neighborID, Priority: distance})
+			}
+		}
+		addCandidates(node.PerLevelNeighbors[level])
+		addCandidates(targetNeighbors)
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Priority < candidates[j].Priority
+		})
+
+		// not extended, the neighbor lists not repaired yet still contain the target
+		candidates = h.selectNeighbors(node.ID, candidates, h.maxNeighbors(level), level, false)
+
+		neighbors := make([]int32, 0, len(candidates))
+		for _, candidate := range candidates {
+			neighbors = append(neighbors, int32(candidate.Value))
+		}
+		h.setNeighbors(node, level, neighbors)
+	}
+}
+
+// replaceEntryPoint pick the highest level node which is not deleted as entry point.
+// when every node is deleted the graph has no entry point, the next AddVector will be the entry point
+func (h *GenericHNSW[T]) replaceEntryPoint() {
+	newEntryPoint := -1
+	for id := 0; id < h.nodes.len(); id++ {
+		node := h.node(id)
+		if node.Deleted || !node.linked {
+			continue
+		}
+		if newEntryPoint == -1 || node.MaxLevel > h.node(newEntryPoint).MaxLevel {
+			newEntryPoint = node.ID
+		}
+	}
+
+	h.entryLock.Lock()
+	defer h.entryLock.Unlock()
+
+	h.entryPoint = newEntryPoint
+	h.curMaxLevel = 0
+	if newEntryPoint != -1 {
+		h.curMaxLevel = h.node(newEntryPoint).MaxLevel
+	}
+}
+
+func containsNode(nodes []int32, id int) bool {
+	for _, nodeID := range nodes {
+		if int(nodeID) == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+package hnsw
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newGridHNSW(t *testing.T) (h *HNSW, ids []int) {
+	t.Helper()
+
+	h = NewHNSW(HNSWOption{
+		M:              4,
+		EfConstruction: 20,
+		EfSearch:       20,
+		MaxLevel:       3,
+		VectorDim:      2,
+
+		RNG: &StaticRNGMachine{Value: staticRNG},
+	})
+
+	// 10x10 grid
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 10; y++ {
+			id, err := h.AddVector([]float32{float32(x), float32(y)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	return
+}
+
+func TestHNSW_Delete(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	// saved again over the larger graph below
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+
+	toDelete := []int{h.entryPoint, ids[11], ids[55], ids[99]}
+	for _, id := range toDelete {
+		if err := h.Delete(id); err != nil {
+			t.Fatalf("unexpected error deleting %d: %v", id, err)
+		}
+	}
+
+	if err := h.Delete(ids[11]); err == nil {
+		t.Errorf("expected error deleting node twice")
+	}
+	if err := h.Delete(len(ids)); err == nil {
+		t.Errorf("expected error deleting unknown node")
+	}
+
+	if h.node(h.entryPoint).Deleted {
+		t.Errorf("entry point %d is deleted", h.entryPoint)
+	}
+
+	assertDeleted(t, h, toDelete)
+
+	// graph is still navigable, every remaining node can be found
+	for _, id := range ids {
+		if h.node(id).Deleted {
+			continue
+		}
+		result, _, err := h.Search(h.vector(id), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 1 || result[0] != id {
+			t.Errorf("expected to find node %d, got %v", id, result)
+		}
+	}
+
+	// deleted set survive save & load
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDeleted(t, loaded, toDelete)
+}
+
+func TestHNSW_DeleteAll(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	for _, id := range ids {
+		if err := h.Delete(id); err != nil {
+			t.Fatalf("unexpected error deleting %d: %v", id, err)
+		}
+	}
+
+	result, _, err := h.Search([]float32{1, 1}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 0 {
+		t.Errorf("expected empty result, got %v", result)
+	}
+
+	// the graph can be used again
+	id, _ := h.AddVector([]float32{1, 1})
+	result, _, _ = h.Search([]float32{1, 1}, 5)
+	if len(result) != 1 || result[0] != id {
+		t.Errorf("expected [%d], got %v", id, result)
+	}
+}
+
+func assertDeleted(t *testing.T, h *HNSW, deleted []int) {
+	t.Helper()
+
+	for _, id := range deleted {
+		if !h.node(id).Deleted {
+			t.Errorf("expected node %d to be deleted", id)
+		}
+
+		result, _, err := h.Search(h.vector(id), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, resultID := range result {
+			if h.node(resultID).Deleted {
+				t.Errorf("deleted node %d returned by search", resultID)
+			}
+		}
+
+		for _, node := range h.nodes.toSlice() {
+			for _, neighbors := range node.PerLevelNeighbors {
+				if containsNode(neighbors, id) {
+					t.Errorf("deleted node %d is still neighbor of %d", id, node.ID)
+				}
+			}
+		}
+	}
+
+	assertInLinks(t, h)
+}
+
+// assertInLinks check the inLinks of every node are the nodes having it as neighbor,
+// or that no node has inLinks when they are not built yet
+func assertInLinks(t *testing.T, h *HNSW) {
+	t.Helper()
+
+	if !h.inLinksBuilt {
+		for _, node := range h.nodes.toSlice() {
+			if node.inLinks != nil {
+				t.Fatalf("node %d has in links before they are built", node.ID)
+			}
+		}
+		return
+	}
+
+	expected := make([][][]int32, h.nodes.len())
+	for _, node := range h.nodes.toSlice() {
+		expected[node.ID] = make([][]int32, node.MaxLevel+1)
+	}
+	for _, node := range h.nodes.toSlice() {
+		for level, neighbors := range node.PerLevelNeighbors {
+			for _, neighbor := range neighbors {
+				expected[neighbor][level] = append(expected[neighbor][level], int32(node.ID))
+			}
+		}
+	}
+
+	for _, node := range h.nodes.toSlice() {
+		for level := range expected[node.ID] {
+			got := slices.Sorted(slices.Values(node.inLinks[level]))
+			slices.Sort(expected[node.ID][level])
+			if !slices.Equal(got, expected[node.ID][level]) {
+				t.Fatalf("node %d level %d: expected in links %v, got %v", node.ID, level, expected[node.ID][level], got)
+			}
+		}
+	}
+}
+
+func TestHNSW_DeleteConcurrentBuild(t *testing.T) {
+	const dim = 16
+
+	rng := rand.New(rand.NewSource(32))
+	vectors := randomVectors(rng, 2000, dim)
+
+	h := NewHNSW(HNSWOption{
+		M:                 8,
+		EfConstruction:    50,
+		EfSearch:          50,
+		VectorDim:         dim,
+		NeighborHeuristic: true,
+
+		RNG: rand.New(rand.NewSource(33)),
+	})
+	ids, err := h.AddVectors(vectors, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.inLinksBuilt {
+		t.Error("expected in links built by the first Update")
+	}
+	assertInLinks(t, h)
+
+	for _, id := range ids[:len(ids)/10] {
+		if err := h.Update(id, randomVectors(rng, 1, dim)[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !h.inLinksBuilt {
+		t.Error("expected in links built by Update")
+	}
+	assertInLinks(t, h)
+
+	deleted := ids[len(ids)/2 : len(ids)/2+len(ids)/10]
+	for _, id := range deleted {
+		if err := h.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertDeleted(t, h, deleted)
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDeleted(t, loaded, deleted)
+
+	// the loaded index builds its in links on the first Delete
+	deleted = append(deleted, ids[0])
+	if err := loaded.Delete(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	assertDeleted(t, loaded, deleted)
+}
+
+func TestHNSW_DeleteDuringAddVectors(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	// allocated by AddVectors, but not linked yet
+	pending, err := h.allocateBatch([][]float32{{20, 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := pending[0].ID
+	if err := h.Delete(id); err == nil {
+		t.Error("expected error deleting node not linked yet")
+	}
+	if err := h.Update(id, []float32{1, 1}); err == nil {
+		t.Error("expected error updating node not linked yet")
+	}
+
+	// saved as if it was never added
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.node(id).Deleted || loaded.Len() != len(ids) {
+		t.Errorf("expected node %d saved as deleted and %d nodes, got %v and %d", id, len(ids), loaded.node(id).Deleted, loaded.Len())
+	}
+
+	h.insertNode(pending[0], []float32{20, 20})
+	if err := h.Delete(id); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHNSW_DeleteConcurrentAddVectors(t *testing.T) {
+	const dim = 16
+
+	rng := rand.New(rand.NewSource(34))
+	h := NewHNSW(HNSWOption{
+		M:              8,
+		EfConstruction: 50,
+		EfSearch:       50,
+		VectorDim:      dim,
+
+		RNG: rand.New(rand.NewSource(35)),
+	})
+	ids, err := h.AddVectors(randomVectors(rng, 500, dim), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := h.AddVectors(randomVectors(rand.New(rand.NewSource(36)), 2000, dim), 4)
+		done <- err
+	}()
+
+	queries := randomVectors(rng, len(ids)/5, dim)
+	for i, id := range ids[:len(ids)/5] {
+		if err := h.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := h.Search(queries[i], 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	assertDeleted(t, h, ids[:len(ids)/5])
+}
+
+func TestHNSW_DeleteExtendCandidates(t *testing.T) {
+	const dim = 8
+
+	rng := rand.New(rand.NewSource(37))
+	h := NewHNSW(HNSWOption{
+		M:                 4,
+		EfConstruction:    32,
+		EfSearch:          32,
+		VectorDim:         dim,
+		NeighborHeuristic: true,
+		ExtendCandidates:  true,
+
+		RNG: rand.New(rand.NewSource(38)),
+	})
+	ids, err := h.AddVectors(randomVectors(rng, 300, dim), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []int
+	for i := 0; i < len(ids); i += 3 {
+		if err := h.Delete(ids[i]); err != nil {
+			t.Fatal(err)
+		}
+		deleted = append(deleted, ids[i])
+	}
+	assertDeleted(t, h, deleted)
+}
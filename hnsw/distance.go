@@ -0,0 +1,82 @@
+package hnsw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Element is the type of the vector elements, see GenericHNSW
+type Element interface {
+	float32 | float64 | int8 | uint8
+}
+
+// GenericDistanceComputer calculates the distance between two vectors, lower is nearer.
+// GetName must be unique and stable, it's saved with the index and used by RegisterDistance
+type GenericDistanceComputer[T Element] interface {
+	CalcDistance(vec1, vec2 []T) float32
+	GetName() string
+}
+
+// DistanceComputer is the GenericDistanceComputer of float32 vectors
+type DistanceComputer = GenericDistanceComputer[float32]
+
+// GenericBoundedDistanceComputer is an optional capability of GenericDistanceComputer.
+// Searching only needs to know whether a node is nearer than the farthest result,
+// so CalcDistanceBounded may stop summing once the partial distance exceeds bound
+// and return that partial distance. When the distance is <= bound, it must be exactly CalcDistance,
+// so the search result and the graph don't depend on which one is used
+type GenericBoundedDistanceComputer[T Element] interface {
+	CalcDistanceBounded(vec1, vec2 []T, bound float32) float32
+}
+
+// BoundedDistanceComputer is the GenericBoundedDistanceComputer of float32 vectors
+type BoundedDistanceComputer = GenericBoundedDistanceComputer[float32]
+
+// boundedChunk is the number of dimensions summed between bound checks,
+// large enough to keep the SIMD kernels busy
+const boundedChunk = 64
+
+var (
+	distanceLock     sync.RWMutex
+	distanceRegistry = map[string]func() DistanceComputer{
+		L2DistanceName:           func() DistanceComputer { return &L2Distance{} },
+		L2SquaredDistanceName:    func() DistanceComputer { return &L2SquaredDistance{} },
+		CosineDistanceName:       func() DistanceComputer { return &CosineDistance{} },
+		InnerProductDistanceName: func() DistanceComputer { return &InnerProductDistance{} },
+		ManhattanDistanceName:    func() DistanceComputer { return &ManhattanDistance{} },
+		ChebyshevDistanceName:    func() DistanceComputer { return &ChebyshevDistance{} },
+		HammingDistanceName:      func() DistanceComputer { return &HammingDistance{} },
+		JaccardDistanceName:      func() DistanceComputer { return &JaccardDistance{} },
+		CanberraDistanceName:     func() DistanceComputer { return &CanberraDistance{} },
+	}
+)
+
+// RegisterDistance make a custom distance loadable by LoadFromDisk, LoadFlatFromDisk and LoadIndex.
+// name must be what the distance GetName returns. Like database/sql.Register,
+// it's meant to be called from init and panics when the name is already registered or factory is nil
+func RegisterDistance(name string, factory func() DistanceComputer) {
+	distanceLock.Lock()
+	defer distanceLock.Unlock()
+
+	if factory == nil {
+		panic("RegisterDistance : factory is nil")
+	}
+	if _, exist := distanceRegistry[name]; exist {
+		panic(fmt.Sprintf("RegisterDistance : %q is already registered", name))
+	}
+
+	distanceRegistry[name] = factory
+}
+
+// newDistance create the distance registered under name
+func newDistance(name string) (DistanceComputer, error) {
+	distanceLock.RLock()
+	defer distanceLock.RUnlock()
+
+	factory, exist := distanceRegistry[name]
+	if !exist {
+		return nil, fmt.Errorf("unknown distance %q, it must be registered by RegisterDistance", name)
+	}
+
+	return factory(), nil
+}
@@ -0,0 +1,148 @@
+package hnsw
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// weightedL1 is a custom distance known only through RegisterDistance
+type weightedL1 struct{}
+
+func (w *weightedL1) CalcDistance(vec1, vec2 []float32) (sum float32) {
+	for i := range vec1 {
+		sum += float32(i+1) * abs(vec1[i]-vec2[i])
+	}
+	return sum
+}
+
+func (w *weightedL1) GetName() string {
+	return "weightedL1"
+}
+
+func TestRegisterDistance(t *testing.T) {
+	h := NewHNSW(HNSWOption{VectorDim: 2, DistanceComputer: &weightedL1{}})
+	h.AddVector([]float32{1, 2})
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown before registering, instead of silently using another distance
+	_, err := LoadFromDisk(path)
+	if err == nil || !strings.Contains(err.Error(), "weightedL1") {
+		t.Fatalf("expected unknown distance error, got %v", err)
+	}
+
+	RegisterDistance("weightedL1", func() DistanceComputer { return &weightedL1{} })
+	t.Cleanup(func() {
+		distanceLock.Lock()
+		defer distanceLock.Unlock()
+		delete(distanceRegistry, "weightedL1")
+	})
+
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := loaded.(*HNSW).distanceComputerFunc.GetName(); name != "weightedL1" {
+		t.Errorf("expected weightedL1 after loading, got %s", name)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic registering a name twice")
+		}
+	}()
+	RegisterDistance(L2DistanceName, func() DistanceComputer { return &L2Distance{} })
+}
+
+func TestBoundedDistance(t *testing.T) {
+	rng := rand.New(rand.NewSource(19))
+	randomVector := func(dim int) []float32 {
+		vector := make([]float32, dim)
+		for i := range vector {
+			vector[i] = rng.Float32()*2 - 1
+		}
+		return vector
+	}
+
+	for _, distance := range []DistanceComputer{
+		&L2Distance{}, &L2SquaredDistance{}, &ManhattanDistance{},
+		&ChebyshevDistance{}, &HammingDistance{}, &CanberraDistance{},
+	} {
+		bounded, ok := distance.(BoundedDistanceComputer)
+		if !ok {
+			t.Fatalf("%s doesn't implement BoundedDistanceComputer", distance.GetName())
+		}
+
+		// longer than boundedChunk so the early abandon happens
+		for _, dim := range []int{1, 7, boundedChunk, 3*boundedChunk + 5} {
+			vec1, vec2 := randomVector(dim), randomVector(dim)
+			exact := distance.CalcDistance(vec1, vec2)
+			tolerance := 1e-4 * max(1, exact)
+
+			// within bound, the distance is exact
+			if got := bounded.CalcDistanceBounded(vec1, vec2, exact+1); got != exact {
+				t.Errorf("%s dim %d: expected %v within bound, got %v", distance.GetName(), dim, exact, got)
+			}
+
+			// beyond bound, anything larger than bound tells the node is too far
+			if exact > 0 {
+				if got := bounded.CalcDistanceBounded(vec1, vec2, exact/2); got <= exact/2 || got > exact+tolerance {
+					t.Errorf("%s dim %d: expected between %v and %v, got %v", distance.GetName(), dim, exact/2, exact, got)
+				}
+			}
+		}
+
+		// the chunks must not round differently than the whole vector
+		for i := 0; i < 1000; i++ {
+			vec1, vec2 := randomVector(768), randomVector(768)
+			exact := distance.CalcDistance(vec1, vec2)
+			if got := bounded.CalcDistanceBounded(vec1, vec2, exact); got != exact {
+				t.Fatalf("%s dim 768: expected %v at the bound, got %v", distance.GetName(), exact, got)
+			}
+		}
+	}
+}
+
+// unbounded hides the BoundedDistanceComputer of the distance
+type unbounded struct {
+	DistanceComputer
+}
+
+func TestHNSW_BoundedSearch(t *testing.T) {
+	// longer than boundedChunk, so the bounded distance is summed by chunks
+	const dim = 3*boundedChunk + 5
+
+	rng := rand.New(rand.NewSource(20))
+	vectors := randomVectors(rng, 1000, dim)
+
+	// the bounded distance must not change the graph nor the result
+	build := func(distance DistanceComputer) *HNSW {
+		h := NewHNSW(HNSWOption{
+			M:                8,
+			EfConstruction:   50,
+			VectorDim:        dim,
+			DistanceComputer: distance,
+
+			RNG: rand.New(rand.NewSource(21)),
+		})
+		for _, vector := range vectors {
+			h.AddVector(vector)
+		}
+		return h
+	}
+	bounded := build(&L2SquaredDistance{})
+	exact := build(&unbounded{&L2SquaredDistance{}})
+
+	for _, query := range vectors[:50] {
+		boundedIDs, boundedDistances, _ := bounded.Search(query, 10)
+		exactIDs, exactDistances, _ := exact.Search(query, 10)
+		if !slices.Equal(boundedIDs, exactIDs) || !slices.Equal(boundedDistances, exactDistances) {
+			t.Fatalf("bounded search differs\n%v %v\n%v %v", boundedIDs, boundedDistances, exactIDs, exactDistances)
+		}
+	}
+}
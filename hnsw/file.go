@@ -2,14 +2,20 @@ package hnsw
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-type HNSWOnDisk struct {
+// GenericHNSWOnDisk is the saved form of GenericHNSW
+type GenericHNSWOnDisk[T Element] struct {
+	IndexType       string // IndexTypeHNSW, used by LoadIndex
+	ElementType     string // type of T, empty is float32
 	M               int
+	M0              int
 	MaxLevel        int
 	VectorDim       int
 	Size            int
@@ -21,29 +27,90 @@ type HNSWOnDisk struct {
 	EfConstruction int
 	EfSearch       int
 
+	NeighborHeuristic     bool
+	ExtendCandidates      bool
+	KeepPrunedConnections bool
+
 	ML                   float64 // mL = 1 / log(M)
 	RNGMachine           string
 	DistanceComputerFunc string
 
-	Vectors [][]float32 // Vectors in the graph
-	Nodes   []*Node     // Nodes in the graph
+	Vectors [][]T   // Vectors in the graph, nil when quantized without rerank
+	Nodes   []*Node // Nodes in the graph
+
+	Quantization string
+	RerankFactor int
+	Quantizer    json.RawMessage // trained parameters of the quantizer
+	Codes        [][]byte        // quantized vectors
 }
 
+// HNSWOnDisk is the saved form of HNSW
+type HNSWOnDisk = GenericHNSWOnDisk[float32]
+
 func LoadFromDisk(filepath string) (*HNSW, error) {
+	return LoadGenericFromDisk[float32](filepath)
+}
+
+// LoadGenericFromDisk load the GenericHNSW saved by SaveToDisk, T must be the saved element type
+func LoadGenericFromDisk[T Element](filepath string) (*GenericHNSW[T], error) {
+	jsonOnDisk, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return hnswFromJSON[T](jsonOnDisk)
+}
+
+func readFile(filepath string) ([]byte, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	onDisk := &HNSWOnDisk{}
-	var jsonOnDisk []byte
-	jsonOnDisk, err = ioutil.ReadAll(file)
+	return ioutil.ReadAll(file)
+}
+
+// writeFile write data to a temporary file next to name and rename it over name,
+// so the file is either the old or the new index, never a mix of both
+func writeFile(name string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp makes the file 0600
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func hnswFromJSON[T Element](jsonOnDisk []byte) (*GenericHNSW[T], error) {
+	onDisk := &GenericHNSWOnDisk[T]{}
+	err := json.Unmarshal(jsonOnDisk, onDisk)
 
-	err = json.Unmarshal(jsonOnDisk, onDisk)
+	// the vectors of another element type may fail to decode, so it's checked first
+	if onDisk.ElementType == "" {
+		onDisk.ElementType = elementType[float32]()
+	}
+	if onDisk.ElementType != elementType[T]() {
+		return nil, fmt.Errorf("LoadFromDisk : the index has %s vectors, expected %s", onDisk.ElementType, elementType[T]())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -51,8 +118,9 @@ func LoadFromDisk(filepath string) (*HNSW, error) {
 	source := rand.NewSource(time.Now().UnixNano())
 	rng := RNGMachine(rand.New(source))
 
-	index := &HNSW{
+	index := &GenericHNSW[T]{
 		M:               onDisk.M,
+		M0:              onDisk.M0,
 		EfConstruction:  onDisk.EfConstruction,
 		EfSearch:        onDisk.EfSearch,
 		size:            onDisk.Size,
@@ -63,17 +131,95 @@ func LoadFromDisk(filepath string) (*HNSW, error) {
 		entryPoint:      onDisk.EntryPoint,
 		rng:             rng,
 		mL:              onDisk.ML,
-		vectors:         onDisk.Vectors,
-		nodes:           onDisk.Nodes,
+		nodes:           newSegmentedSlice[*Node](onDisk.Size),
+
+		neighborHeuristic:     onDisk.NeighborHeuristic,
+		extendCandidates:      onDisk.ExtendCandidates,
+		keepPrunedConnections: onDisk.KeepPrunedConnections,
+
+		quantization: onDisk.Quantization,
+		rerankFactor: onDisk.RerankFactor,
+	}
+
+	index.distanceComputerFunc, err = newGenericDistance[T](onDisk.DistanceComputerFunc)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFromDisk : %w", err)
+	}
+
+	index.quantizer, err = newQuantizer(GenericHNSWOption[T]{Quantization: onDisk.Quantization, VectorDim: onDisk.VectorDim}, index.distanceComputerFunc)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFromDisk : %w", err)
+	}
+
+	if index.quantizer == nil || index.rerankFactor > 0 {
+		if len(onDisk.Vectors) != len(onDisk.Nodes) {
+			return nil, fmt.Errorf("LoadFromDisk : %d vectors but %d nodes", len(onDisk.Vectors), len(onDisk.Nodes))
+		}
+		for idx, vector := range onDisk.Vectors {
+			if len(vector) != onDisk.VectorDim {
+				return nil, fmt.Errorf("LoadFromDisk : vector %d has dimension %d, expected %d", idx, len(vector), onDisk.VectorDim)
+			}
+		}
+		index.vectors = newVectorArena[T](onDisk.Size, onDisk.VectorDim)
+	}
+
+	if index.quantizer != nil {
+		if len(onDisk.Quantizer) > 0 {
+			err = json.Unmarshal(onDisk.Quantizer, index.quantizer)
+			if err != nil {
+				return nil, fmt.Errorf("LoadFromDisk : %w", err)
+			}
+		}
+		err = index.quantizer.validate()
+		if err != nil {
+			return nil, fmt.Errorf("LoadFromDisk : %w", err)
+		}
+
+		if len(onDisk.Codes) != len(onDisk.Nodes) {
+			return nil, fmt.Errorf("LoadFromDisk : %d codes but %d nodes", len(onDisk.Codes), len(onDisk.Nodes))
+		}
+		codeSize := index.quantizer.codeSize()
+		for idx, code := range onDisk.Codes {
+			if len(code) != codeSize {
+				return nil, fmt.Errorf("LoadFromDisk : code %d has %d bytes, expected %d", idx, len(code), codeSize)
+			}
+		}
+		index.codes = newVectorArena[byte](onDisk.Size, codeSize)
+	}
+
+	for idx := range onDisk.Nodes {
+		if index.vectors != nil {
+			index.vectors.append(onDisk.Vectors[idx])
+		}
+		if index.codes != nil {
+			index.codes.append(onDisk.Codes[idx])
+		}
+		index.nodes.append(onDisk.Nodes[idx])
+		if onDisk.Nodes[idx].Deleted {
+			index.deletedCount++
+		}
+	}
+
+	// inLinks are built by the first Delete or Update, it relies on valid neighbors
+	for idx, node := range onDisk.Nodes {
+		node.linked = true
+		for level, neighbors := range node.PerLevelNeighbors {
+			for _, neighbor := range neighbors {
+				if neighbor < 0 || int(neighbor) >= len(onDisk.Nodes) || level >= len(onDisk.Nodes[neighbor].PerLevelNeighbors) {
+					return nil, fmt.Errorf("LoadFromDisk : node %d has invalid neighbor %d on level %d", idx, neighbor, level)
+				}
+			}
+		}
+	}
+
+	// saved before M0 exists
+	if index.M0 == 0 {
+		index.M0 = 2 * index.M
 	}
 
-	switch onDisk.DistanceComputerFunc {
-	case l2DistanceName:
-		index.distanceComputerFunc = &L2Distance{}
-	case L2SquaredDistanceName:
-		index.distanceComputerFunc = &L2SquaredDistance{}
-	default:
-		index.distanceComputerFunc = &L2SquaredDistance{}
+	// empty graph has no entry point
+	if len(onDisk.Nodes) == 0 {
+		index.entryPoint = -1
 	}
 
 	return index, nil
@@ -0,0 +1,276 @@
+package hnsw
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// minFlatChunk is the minimum number of vectors scanned by a Search goroutine,
+// smaller chunk costs more in goroutines than it saves
+const minFlatChunk = 4096
+
+type FlatOption struct {
+	VectorDim        int
+	DistanceComputer DistanceComputer
+	NormalizeVector  bool
+
+	// Workers is the number of goroutines scanning the vectors in Search, 0 means GOMAXPROCS
+	Workers int
+
+	// initial capacity, like HNSWOption.Size
+	Size int
+}
+
+// FlatIndex compare the query with every vector, so the result is exact.
+// It's meant for small collections and as ground truth when measuring HNSW recall.
+// FlatIndex is safe for concurrent use
+type FlatIndex struct {
+	vectorDim       int
+	normalizeVector bool
+	workers         int
+
+	distanceComputerFunc DistanceComputer
+
+	vectors      [][]float32
+	deleted      []bool
+	deletedCount int
+
+	lock sync.RWMutex
+}
+
+type FlatOnDisk struct {
+	IndexType       string // IndexTypeFlat, used by LoadIndex
+	VectorDim       int
+	NormalizeVector bool
+
+	DistanceComputerFunc string
+
+	Vectors [][]float32
+	Deleted []bool
+}
+
+// NewFlatIndex creates a new FlatIndex with the given options
+func NewFlatIndex(option FlatOption) *FlatIndex {
+	if option.VectorDim == 0 {
+		option.VectorDim = defaultVectorDim
+	}
+	if option.Size == 0 {
+		option.Size = defaultSize
+	}
+
+	distanceComputerFunc := DistanceComputer(&L2Distance{})
+	if option.DistanceComputer != nil {
+		distanceComputerFunc = option.DistanceComputer
+	}
+
+	return &FlatIndex{
+		vectorDim:            option.VectorDim,
+		normalizeVector:      option.NormalizeVector,
+		workers:              option.Workers,
+		distanceComputerFunc: distanceComputerFunc,
+		vectors:              make([][]float32, 0, option.Size),
+		deleted:              make([]bool, 0, option.Size),
+	}
+}
+
+func (f *FlatIndex) AddVector(vector []float32) (id int, err error) {
+	if len(vector) != f.vectorDim {
+		err = fmt.Errorf("AddVector : Different vector dimension. Got %d expected %d", len(vector), f.vectorDim)
+		return 0, err
+	}
+
+	// the caller may reuse its slice, normalize already returns a copy
+	if f.normalizeVector {
+		vector = normalize(vector)
+	} else {
+		vector = append([]float32(nil), vector...)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.vectors = append(f.vectors, vector)
+	f.deleted = append(f.deleted, false)
+
+	return len(f.vectors) - 1, nil
+}
+
+// Search compare the query with every vector using multiple goroutines
+// the output is sorted by distance, closest is index 0
+func (f *FlatIndex) Search(VecToSearch []float32, topK int) (resultNodeID []int, resultDistance []float32, err error) {
+	if len(VecToSearch) != f.vectorDim {
+		err = fmt.Errorf("Search : Different vector dimension. Got %d expected %d", len(VecToSearch), f.vectorDim)
+		return
+	}
+	if topK <= 0 {
+		return
+	}
+
+	if f.normalizeVector {
+		VecToSearch = normalize(VecToSearch)
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	workers := f.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunk := (len(f.vectors) + workers - 1) / workers
+	if chunk < minFlatChunk {
+		chunk = minFlatChunk
+	}
+
+	// every chunk keeps its own topK, merged at the end
+	var parts []priorityQueue[pqItem]
+	for start := 0; start < len(f.vectors); start += chunk {
+		parts = append(parts, newPriorityQueueMax(topK+1))
+	}
+
+	var wg sync.WaitGroup
+	for idx := range parts {
+		wg.Add(1)
+		go func(found *priorityQueue[pqItem], start int) {
+			defer wg.Done()
+			f.scan(VecToSearch, start, min(start+chunk, len(f.vectors)), topK, found)
+		}(&parts[idx], idx*chunk)
+	}
+	wg.Wait()
+
+	found := newPriorityQueueMax(topK + 1)
+	for idx := range parts {
+		for parts[idx].Len() > 0 {
+			found.Push(parts[idx].Pop())
+			if found.Len() > topK {
+				found.Pop()
+			}
+		}
+	}
+
+	// pop from farthest, fill from the back
+	resultNodeID = make([]int, found.Len())
+	resultDistance = make([]float32, found.Len())
+	for idx := len(resultNodeID) - 1; idx >= 0; idx-- {
+		item := found.Pop()
+		resultNodeID[idx] = item.Value
+		resultDistance[idx] = item.Priority
+	}
+
+	return
+}
+
+// scan keeps the topK nearest vectors between start and end in found
+func (f *FlatIndex) scan(VecToSearch []float32, start int, end int, topK int, found *priorityQueue[pqItem]) {
+	for id := start; id < end; id++ {
+		if f.deleted[id] {
+			continue
+		}
+
+		dist := f.distanceComputerFunc.CalcDistance(VecToSearch, f.vectors[id])
+		if found.Len() >= topK && dist >= found.Top().Priority {
+			continue
+		}
+
+		found.Push(pqItem{Value: id, Priority: dist})
+		if found.Len() > topK {
+			found.Pop()
+		}
+	}
+}
+
+// Delete mark the vector as deleted so it won't be returned by Search. The ID is never reused.
+func (f *FlatIndex) Delete(id int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if id < 0 || id >= len(f.vectors) {
+		return fmt.Errorf("Delete : node %d not found", id)
+	}
+	if f.deleted[id] {
+		return fmt.Errorf("Delete : node %d already deleted", id)
+	}
+
+	f.deleted[id] = true
+	f.deletedCount++
+
+	return nil
+}
+
+// Len return the number of vectors that are not deleted
+func (f *FlatIndex) Len() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return len(f.vectors) - f.deletedCount
+}
+
+func (f *FlatIndex) SaveToDisk(filepath string) error {
+	json, err := f.marshal()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath, json)
+}
+
+func (f *FlatIndex) marshal() ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	onDisk := &FlatOnDisk{
+		IndexType:            IndexTypeFlat,
+		VectorDim:            f.vectorDim,
+		NormalizeVector:      f.normalizeVector,
+		DistanceComputerFunc: f.distanceComputerFunc.GetName(),
+		Vectors:              f.vectors,
+		Deleted:              f.deleted,
+	}
+
+	return json.Marshal(onDisk)
+}
+
+func LoadFlatFromDisk(filepath string) (*FlatIndex, error) {
+	jsonOnDisk, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return flatFromJSON(jsonOnDisk)
+}
+
+func flatFromJSON(jsonOnDisk []byte) (*FlatIndex, error) {
+	onDisk := &FlatOnDisk{}
+	err := json.Unmarshal(jsonOnDisk, onDisk)
+	if err != nil {
+		return nil, err
+	}
+
+	distanceComputerFunc, err := newDistance(onDisk.DistanceComputerFunc)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFlatFromDisk : %w", err)
+	}
+
+	index := &FlatIndex{
+		vectorDim:            onDisk.VectorDim,
+		normalizeVector:      onDisk.NormalizeVector,
+		distanceComputerFunc: distanceComputerFunc,
+		vectors:              onDisk.Vectors,
+		deleted:              onDisk.Deleted,
+	}
+
+	// every vector has a deleted flag
+	if len(index.deleted) != len(index.vectors) {
+		return nil, fmt.Errorf("LoadFlatFromDisk : %d vectors but %d deleted flags", len(index.vectors), len(index.deleted))
+	}
+
+	for _, deleted := range index.deleted {
+		if deleted {
+			index.deletedCount++
+		}
+	}
+
+	return index, nil
+}
@@ -0,0 +1,104 @@
+package hnsw
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFlatIndex_Search(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	vectors := make([][]float32, 3*minFlatChunk)
+	for i := range vectors {
+		vectors[i] = []float32{rng.Float32(), rng.Float32(), rng.Float32()}
+	}
+
+	// several goroutines, one goroutine
+	parallel := NewFlatIndex(FlatOption{VectorDim: 3, Workers: 4, DistanceComputer: &L2SquaredDistance{}})
+	serial := NewFlatIndex(FlatOption{VectorDim: 3, Workers: 1, DistanceComputer: &L2SquaredDistance{}})
+	for idx, vector := range vectors {
+		id, err := parallel.AddVector(vector)
+		if err != nil || id != idx {
+			t.Fatalf("expected id %d, got %d (%v)", idx, id, err)
+		}
+		serial.AddVector(vector)
+	}
+
+	query := []float32{0.5, 0.5, 0.5}
+
+	// naive reference
+	exact := make([]int, len(vectors))
+	for i := range exact {
+		exact[i] = i
+	}
+	distance := &L2SquaredDistance{}
+	sort.SliceStable(exact, func(i, j int) bool {
+		return distance.CalcDistance(query, vectors[exact[i]]) < distance.CalcDistance(query, vectors[exact[j]])
+	})
+
+	for _, index := range []*FlatIndex{parallel, serial} {
+		resultNodeID, resultDistance, err := index.Search(query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resultNodeID) != 10 {
+			t.Fatalf("expected 10 results, got %d", len(resultNodeID))
+		}
+		for idx := range resultNodeID {
+			expected := distance.CalcDistance(query, vectors[exact[idx]])
+			if resultDistance[idx] != expected {
+				t.Errorf("expected distance %f at index %d, got %f", expected, idx, resultDistance[idx])
+			}
+		}
+	}
+
+	if _, _, err := parallel.Search([]float32{1}, 10); err == nil {
+		t.Errorf("expected error on different dimension")
+	}
+
+	// the vector is copied, reusing the slice doesn't change the index
+	reused := []float32{100, 100, 100}
+	id, _ := serial.AddVector(reused)
+	reused[0] = 0.5
+	if serial.vectors[id][0] != 100 {
+		t.Errorf("expected the added vector to be copied, got %v", serial.vectors[id])
+	}
+}
+
+func TestFlatIndex_DeleteSaveLoad(t *testing.T) {
+	f := NewFlatIndex(FlatOption{VectorDim: 2})
+	for i := 0; i < 10; i++ {
+		f.AddVector([]float32{float32(i), 0})
+	}
+
+	if err := f.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(3); err == nil {
+		t.Errorf("expected error deleting twice")
+	}
+	if err := f.Delete(10); err == nil {
+		t.Errorf("expected error deleting unknown id")
+	}
+	if f.Len() != 9 {
+		t.Errorf("expected len 9, got %d", f.Len())
+	}
+
+	path := filepath.Join(t.TempDir(), "flat.db")
+	if err := f.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFlatFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 9 || loaded.distanceComputerFunc.GetName() != L2DistanceName {
+		t.Errorf("expected 9 vectors using %s, got %d using %s", L2DistanceName, loaded.Len(), loaded.distanceComputerFunc.GetName())
+	}
+
+	resultNodeID, resultDistance, _ := loaded.Search([]float32{3, 0}, 2)
+	if len(resultNodeID) != 2 || resultNodeID[0] == 3 || resultDistance[0] != 1 || resultDistance[1] != 1 {
+		t.Errorf("expected 2 and 4 at distance 1, got %v %v", resultNodeID, resultDistance)
+	}
+}
@@ -0,0 +1,272 @@
+package hnsw
+
+import (
+	"fmt"
+	"math"
+)
+
+// The distances of GenericHNSW for every Element type. They compute in float64 so int8 and uint8 don't overflow,
+// float32 vectors should use the non generic distances which use SIMD.
+// GetName is the same as the non generic distance, so the saved index loads with any element type
+type (
+	GenericL2Distance[T Element]           struct{}
+	GenericL2SquaredDistance[T Element]    struct{}
+	GenericCosineDistance[T Element]       struct{}
+	GenericInnerProductDistance[T Element] struct{}
+	GenericManhattanDistance[T Element]    struct{}
+	GenericChebyshevDistance[T Element]    struct{}
+	GenericHammingDistance[T Element]      struct{}
+	GenericJaccardDistance[T Element]      struct{}
+	GenericCanberraDistance[T Element]     struct{}
+)
+
+func genericL2Squared[T Element](vec1, vec2 []T) (sumOfSquares float64) {
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		diff := float64(vec1[i]) - float64(vec2[i])
+		sumOfSquares += diff * diff
+	}
+	return sumOfSquares
+}
+
+func (L2 *GenericL2Distance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	return float32(math.Sqrt(genericL2Squared(vec1, vec2)))
+}
+
+func (L2 *GenericL2Distance[T]) GetName() string {
+	return L2DistanceName
+}
+
+func (L2 *GenericL2SquaredDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	return float32(genericL2Squared(vec1, vec2))
+}
+
+func (L2 *GenericL2SquaredDistance[T]) GetName() string {
+	return L2SquaredDistanceName
+}
+
+// CalcDistance is 1 - cosine similarity, zero vector has distance 1 like CosineDistance
+func (c *GenericCosineDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var dot, norm1, norm2 float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		dot += float64(vec1[i]) * float64(vec2[i])
+		norm1 += float64(vec1[i]) * float64(vec1[i])
+		norm2 += float64(vec2[i]) * float64(vec2[i])
+	}
+	if norm1 == 0 || norm2 == 0 {
+		return 1
+	}
+
+	return float32(1 - dot/(math.Sqrt(norm1)*math.Sqrt(norm2)))
+}
+
+func (c *GenericCosineDistance[T]) GetName() string {
+	return CosineDistanceName
+}
+
+func (ip *GenericInnerProductDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var dot float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		dot += float64(vec1[i]) * float64(vec2[i])
+	}
+	return float32(-dot)
+}
+
+func (ip *GenericInnerProductDistance[T]) GetName() string {
+	return InnerProductDistanceName
+}
+
+func (m *GenericManhattanDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var sum float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		sum += math.Abs(float64(vec1[i]) - float64(vec2[i]))
+	}
+	return float32(sum)
+}
+
+func (m *GenericManhattanDistance[T]) GetName() string {
+	return ManhattanDistanceName
+}
+
+func (c *GenericChebyshevDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var largest float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		largest = max(largest, math.Abs(float64(vec1[i])-float64(vec2[i])))
+	}
+	return float32(largest)
+}
+
+func (c *GenericChebyshevDistance[T]) GetName() string {
+	return ChebyshevDistanceName
+}
+
+// CalcDistance counts the dimensions where one vector is positive and the other is not
+func (h *GenericHammingDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var count float32
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		if (vec1[i] > 0) != (vec2[i] > 0) {
+			count++
+		}
+	}
+	return count
+}
+
+func (h *GenericHammingDistance[T]) GetName() string {
+	return HammingDistanceName
+}
+
+// CalcDistance is the weighted Jaccard distance of JaccardDistance, the vectors must not be negative
+func (j *GenericJaccardDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var sumMin, sumMax float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		sumMin += float64(min(vec1[i], vec2[i]))
+		sumMax += float64(max(vec1[i], vec2[i]))
+	}
+	if sumMax == 0 {
+		return 0
+	}
+	return float32(1 - sumMin/sumMax)
+}
+
+func (j *GenericJaccardDistance[T]) GetName() string {
+	return JaccardDistanceName
+}
+
+func (c *GenericCanberraDistance[T]) CalcDistance(vec1, vec2 []T) float32 {
+	var sum float64
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		denominator := math.Abs(float64(vec1[i])) + math.Abs(float64(vec2[i]))
+		if denominator == 0 {
+			continue
+		}
+		sum += math.Abs(float64(vec1[i])-float64(vec2[i])) / denominator
+	}
+	return float32(sum)
+}
+
+func (c *GenericCanberraDistance[T]) GetName() string {
+	return CanberraDistanceName
+}
+
+// genericDistanceKey is the name of a custom distance and the element type of its vectors
+type genericDistanceKey struct {
+	elementType string
+	name        string
+}
+
+// genericDistanceRegistry hold the func() GenericDistanceComputer[T] of the custom distances
+// of non float32 vectors, guarded by distanceLock
+var genericDistanceRegistry = map[genericDistanceKey]any{}
+
+// RegisterGenericDistance is RegisterDistance for GenericHNSW of T, so LoadGenericFromDisk can load
+// a saved index using a custom distance. float32 distances are registered by RegisterDistance.
+// It panics when the name is already registered for T, the generic distances are registered for every T
+func RegisterGenericDistance[T Element](name string, factory func() GenericDistanceComputer[T]) {
+	if isFloat32[T]() {
+		RegisterDistance(name, any(factory).(func() DistanceComputer))
+		return
+	}
+
+	distanceLock.Lock()
+	defer distanceLock.Unlock()
+
+	if factory == nil {
+		panic("RegisterGenericDistance : factory is nil")
+	}
+	key := genericDistanceKey{elementType: elementType[T](), name: name}
+	if _, exist := genericDistanceRegistry[key]; exist || builtinGenericDistance[T](name) != nil {
+		panic(fmt.Sprintf("RegisterGenericDistance : %q is already registered for %s", name, key.elementType))
+	}
+
+	genericDistanceRegistry[key] = factory
+}
+
+// newGenericDistance create the distance named name for T vectors,
+// float32 uses the RegisterDistance registry and the other types RegisterGenericDistance one
+func newGenericDistance[T Element](name string) (GenericDistanceComputer[T], error) {
+	if isFloat32[T]() {
+		distance, err := newDistance(name)
+		if err != nil {
+			return nil, err
+		}
+		return any(distance).(GenericDistanceComputer[T]), nil
+	}
+
+	if distance := builtinGenericDistance[T](name); distance != nil {
+		return distance, nil
+	}
+
+	distanceLock.RLock()
+	defer distanceLock.RUnlock()
+
+	factory, exist := genericDistanceRegistry[genericDistanceKey{elementType: elementType[T](), name: name}]
+	if !exist {
+		return nil, fmt.Errorf("unknown distance %q for %s vectors, it must be registered by RegisterGenericDistance", name, elementType[T]())
+	}
+
+	return factory.(func() GenericDistanceComputer[T])(), nil
+}
+
+// builtinGenericDistance return the generic distance named name, nil when there is none
+func builtinGenericDistance[T Element](name string) GenericDistanceComputer[T] {
+	switch name {
+	case L2DistanceName:
+		return &GenericL2Distance[T]{}
+	case L2SquaredDistanceName:
+		return &GenericL2SquaredDistance[T]{}
+	case CosineDistanceName:
+		return &GenericCosineDistance[T]{}
+	case InnerProductDistanceName:
+		return &GenericInnerProductDistance[T]{}
+	case ManhattanDistanceName:
+		return &GenericManhattanDistance[T]{}
+	case ChebyshevDistanceName:
+		return &GenericChebyshevDistance[T]{}
+	case HammingDistanceName:
+		return &GenericHammingDistance[T]{}
+	case JaccardDistanceName:
+		return &GenericJaccardDistance[T]{}
+	case CanberraDistanceName:
+		return &GenericCanberraDistance[T]{}
+	default:
+		return nil
+	}
+}
+
+// defaultDistance is L2, the SIMD one for float32
+func defaultDistance[T Element]() GenericDistanceComputer[T] {
+	if isFloat32[T]() {
+		return any(&L2Distance{}).(GenericDistanceComputer[T])
+	}
+	return &GenericL2Distance[T]{}
+}
+
+func isFloat32[T Element]() bool {
+	var zero T
+	_, ok := any(zero).(float32)
+	return ok
+}
+
+// isFloat report whether T can be normalized
+func isFloat[T Element]() bool {
+	var zero T
+	switch any(zero).(type) {
+	case float32, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// elementType is the name of T, it's saved with the index
+func elementType[T Element]() string {
+	var zero T
+	return fmt.Sprintf("%T", zero)
+}
@@ -0,0 +1,266 @@
+package hnsw
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGenericDistance(t *testing.T) {
+	rng := rand.New(rand.NewSource(27))
+	vec1, vec2 := make([]float32, 37), make([]float32, 37)
+	for i := range vec1 {
+		vec1[i] = rng.Float32()
+		vec2[i] = rng.Float32()
+	}
+	vec1[3], vec2[3] = 0, 0 // canberra skips 0/0
+
+	float64Vector := func(vector []float32) []float64 {
+		converted := make([]float64, len(vector))
+		for i := range vector {
+			converted[i] = float64(vector[i])
+		}
+		return converted
+	}
+
+	for _, name := range []string{L2DistanceName, L2SquaredDistanceName, CosineDistanceName, InnerProductDistanceName,
+		ManhattanDistanceName, ChebyshevDistanceName, HammingDistanceName, JaccardDistanceName, CanberraDistanceName} {
+		expected, err := newDistance(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generic, err := newGenericDistance[float64](name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if generic.GetName() != name {
+			t.Errorf("expected name %s, got %s", name, generic.GetName())
+		}
+
+		want := expected.CalcDistance(vec1, vec2)
+		got := generic.CalcDistance(float64Vector(vec1), float64Vector(vec2))
+		if math.Abs(float64(want-got)) > 1e-4*math.Max(1, math.Abs(float64(want))) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	if _, err := newGenericDistance[uint8]("unknown"); err == nil {
+		t.Error("expected error on unknown distance")
+	}
+
+	// computed in float64, so uint8 doesn't overflow
+	a, b := []uint8{255, 0}, []uint8{0, 255}
+	if got := (&GenericL2SquaredDistance[uint8]{}).CalcDistance(a, b); got != 2*255*255 {
+		t.Errorf("expected %v, got %v", 2*255*255, got)
+	}
+	if got := (&GenericInnerProductDistance[int8]{}).CalcDistance([]int8{-128, 127}, []int8{-128, 127}); got != -(128*128 + 127*127) {
+		t.Errorf("expected %v, got %v", -(128*128 + 127*127), got)
+	}
+}
+
+func TestGenericHNSW(t *testing.T) {
+	const dim = 16
+
+	rng := rand.New(rand.NewSource(28))
+	randomBytes := func(n int) [][]uint8 {
+		vectors := make([][]uint8, n)
+		for i := range vectors {
+			vectors[i] = make([]uint8, dim)
+			for j := range vectors[i] {
+				vectors[i][j] = uint8(rng.Intn(256))
+			}
+		}
+		return vectors
+	}
+	vectors := randomBytes(2000)
+	queries := randomBytes(50)
+
+	h := NewGenericHNSW(GenericHNSWOption[uint8]{
+		M:              16,
+		EfConstruction: 100,
+		EfSearch:       100,
+		VectorDim:      dim,
+
+		RNG: rand.New(rand.NewSource(29)),
+	})
+	ids, err := h.AddVectors(vectors, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// brute force
+	distance := &GenericL2Distance[uint8]{}
+	var found int
+	for _, query := range queries {
+		order := make([]int, len(vectors))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return distance.CalcDistance(query, vectors[order[i]]) < distance.CalcDistance(query, vectors[order[j]])
+		})
+		expected := make(map[int]bool, 10)
+		for _, idx := range order[:10] {
+			expected[ids[idx]] = true
+		}
+
+		result, distances, err := h.Search(query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, id := range result {
+			if expected[id] {
+				found++
+			}
+			if exact := distance.CalcDistance(query, vectors[id]); distances[i] != exact {
+				t.Fatalf("expected distance %v, got %v", exact, distances[i])
+			}
+		}
+	}
+	if recall := float64(found) / float64(len(queries)*10); recall < 0.95 {
+		t.Errorf("expected recall@10 at least 0.95, got %v", recall)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGenericFromDisk[uint8](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries[:10] {
+		expectedIDs, expectedDistances, _ := h.Search(query, 10)
+		gotIDs, gotDistances, _ := loaded.Search(query, 10)
+		if !slices.Equal(expectedIDs, gotIDs) || !slices.Equal(expectedDistances, gotDistances) {
+			t.Fatalf("search differs after loading\n%v %v\n%v %v", expectedIDs, expectedDistances, gotIDs, gotDistances)
+		}
+	}
+
+	// the element type is checked, uint8 vectors are saved as base64 and int8 as numbers
+	if _, err := LoadFromDisk(path); err == nil || !strings.Contains(err.Error(), "uint8") {
+		t.Errorf("expected element type error loading as float32, got %v", err)
+	}
+	if _, err := LoadGenericFromDisk[int8](path); err == nil {
+		t.Error("expected element type error loading as int8")
+	}
+}
+
+func TestGenericHNSW_Float64(t *testing.T) {
+	h := NewGenericHNSW(GenericHNSWOption[float64]{
+		VectorDim:        2,
+		DistanceComputer: &GenericCosineDistance[float64]{},
+		NormalizeVector:  true,
+	})
+	for _, vector := range [][]float64{{1, 0}, {0, 1}, {1, 1}, {-1, 0}} {
+		if _, err := h.AddVector(vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, distances, err := h.Search([]float64{3, 3}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[0] != 2 || math.Abs(float64(distances[0])) > 1e-6 {
+		t.Errorf("expected node 2 at distance 0, got %v %v", ids, distances)
+	}
+
+	if err := h.Update(3, []float64{1, 1e-9}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.AddVector([]float64{1}); err == nil {
+		t.Error("expected dimension error")
+	}
+
+	// loading a float64 index into a float32 one would lose precision silently
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFromDisk(path); err == nil {
+		t.Error("expected element type error loading as float32")
+	}
+	if _, err := LoadGenericFromDisk[float64](path); err != nil {
+		t.Error(err)
+	}
+}
+
+// weightedUint8L1 is a custom uint8 distance known only through RegisterGenericDistance
+type weightedUint8L1 struct{}
+
+func (w *weightedUint8L1) CalcDistance(vec1, vec2 []uint8) (sum float32) {
+	for i := range vec1 {
+		sum += float32(i+1) * abs(float32(vec1[i])-float32(vec2[i]))
+	}
+	return sum
+}
+
+func (w *weightedUint8L1) GetName() string {
+	return "weightedUint8L1"
+}
+
+func TestRegisterGenericDistance(t *testing.T) {
+	h := NewGenericHNSW(GenericHNSWOption[uint8]{VectorDim: 2, DistanceComputer: &weightedUint8L1{}})
+	h.AddVector([]uint8{1, 2})
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadGenericFromDisk[uint8](path)
+	if err == nil || !strings.Contains(err.Error(), "weightedUint8L1") {
+		t.Fatalf("expected unknown distance error, got %v", err)
+	}
+
+	RegisterGenericDistance("weightedUint8L1", func() GenericDistanceComputer[uint8] { return &weightedUint8L1{} })
+	t.Cleanup(func() {
+		distanceLock.Lock()
+		defer distanceLock.Unlock()
+		delete(genericDistanceRegistry, genericDistanceKey{elementType: "uint8", name: "weightedUint8L1"})
+	})
+
+	loaded, err := LoadGenericFromDisk[uint8](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := loaded.distanceComputerFunc.GetName(); name != "weightedUint8L1" {
+		t.Errorf("expected weightedUint8L1 after loading, got %s", name)
+	}
+
+	// registered for uint8 only
+	if _, err := newGenericDistance[int8]("weightedUint8L1"); err == nil {
+		t.Error("expected unknown distance for int8")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic registering a generic distance name")
+		}
+	}()
+	RegisterGenericDistance(L2DistanceName, func() GenericDistanceComputer[uint8] { return &GenericL2Distance[uint8]{} })
+}
+
+func TestNewGenericHNSW_Panic(t *testing.T) {
+	for name, newIndex := range map[string]func(){
+		"normalize int8": func() {
+			NewGenericHNSW(GenericHNSWOption[int8]{VectorDim: 2, NormalizeVector: true})
+		},
+		"quantize uint8": func() {
+			NewGenericHNSW(GenericHNSWOption[uint8]{VectorDim: 2, Quantization: QuantizationSQ8})
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			newIndex()
+		}()
+	}
+}
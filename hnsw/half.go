@@ -0,0 +1,151 @@
+package hnsw
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// halfQuantizer is the quantizer of QuantizationFloat16 and QuantizationBFloat16.
+// Every dimension is stored as 16 bits little endian, rounded to nearest even.
+// The distance converts the code back to float32 and uses the distance computer
+type halfQuantizer struct {
+	vectorDim int
+	bfloat    bool
+	distance  DistanceComputer
+}
+
+func newHalfQuantizer(vectorDim int, bfloat bool, distance DistanceComputer) *halfQuantizer {
+	return &halfQuantizer{vectorDim: vectorDim, bfloat: bfloat, distance: distance}
+}
+
+func (q *halfQuantizer) train(samples [][]float32) error {
+	return nil
+}
+
+func (q *halfQuantizer) trained() bool {
+	return true
+}
+
+func (q *halfQuantizer) validate() error {
+	return nil
+}
+
+func (q *halfQuantizer) codeSize() int {
+	return 2 * q.vectorDim
+}
+
+func (q *halfQuantizer) encode(vector []float32) []byte {
+	code := make([]byte, 0, q.codeSize())
+	for _, value := range vector {
+		if q.bfloat {
+			code = binary.LittleEndian.AppendUint16(code, float32ToBFloat16(value))
+		} else {
+			code = binary.LittleEndian.AppendUint16(code, float32ToFloat16(value))
+		}
+	}
+
+	return code
+}
+
+func (q *halfQuantizer) decode(code []byte) []float32 {
+	return q.decodeInto(code, make([]float32, q.vectorDim))
+}
+
+func (q *halfQuantizer) decodeInto(code []byte, vector []float32) []float32 {
+	code = code[:2*len(vector)]
+	for i := range vector {
+		half := binary.LittleEndian.Uint16(code[2*i:])
+		if q.bfloat {
+			vector[i] = bfloat16ToFloat32(half)
+		} else {
+			vector[i] = float16ToFloat32(half)
+		}
+	}
+
+	return vector
+}
+
+func (q *halfQuantizer) queryDistance(query []float32) codeDistance {
+	return newDecodedDistance(q, q.distance, query)
+}
+
+func (q *halfQuantizer) nodeDistance(code []byte) codeDistance {
+	return newDecodedDistance(q, q.distance, q.decode(code))
+}
+
+// float32ToFloat16 convert to IEEE 754 half precision, 5 bits exponent and 10 bits mantissa.
+// Too large value becomes infinity and too small becomes subnormal or zero
+func float32ToFloat16(value float32) uint16 {
+	bits := math.Float32bits(value)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	// NaN stays NaN
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+	// below half of the smallest subnormal
+	case exponent < -10:
+		return sign
+	case exponent <= 0:
+		// subnormal, the implicit leading bit becomes explicit
+		mantissa |= 0x800000
+		shift := uint(14 - exponent)
+		half := mantissa >> shift
+		remainder := mantissa & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if remainder > halfway || remainder == halfway && half&1 == 1 {
+			half++
+		}
+		return sign | uint16(half)
+	default:
+		// rounding up may carry into the exponent, up to infinity, which is still right
+		half := uint32(exponent)<<10 | mantissa>>13
+		remainder := mantissa & 0x1fff
+		if remainder > 0x1000 || remainder == 0x1000 && half&1 == 1 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+}
+
+func float16ToFloat32(half uint16) float32 {
+	sign := uint32(half&0x8000) << 16
+	exponent := uint32(half>>10) & 0x1f
+	mantissa := uint32(half & 0x3ff)
+
+	switch exponent {
+	// infinity and NaN
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+	// zero and subnormal, mantissa * 2^-24
+	case 0:
+		value := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+		return value
+	default:
+		return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+	}
+}
+
+// float32ToBFloat16 keep the upper 16 bits, bfloat16 has the float32 exponent and 7 bits mantissa
+func float32ToBFloat16(value float32) uint16 {
+	bits := math.Float32bits(value)
+
+	// rounding could turn NaN into infinity, keep it a quiet NaN
+	if bits&0x7fffffff > 0x7f800000 {
+		return uint16(bits>>16) | 0x40
+	}
+
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
+
+func bfloat16ToFloat32(half uint16) float32 {
+	return math.Float32frombits(uint32(half) << 16)
+}
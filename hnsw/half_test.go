@@ -0,0 +1,141 @@
+package hnsw
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFloat16(t *testing.T) {
+	// every half is converted back to itself
+	for half := 0; half <= math.MaxUint16; half++ {
+		value := float16ToFloat32(uint16(half))
+		if value != value {
+			if got := float32ToFloat16(value); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+				t.Errorf("NaN %#04x converted to %#04x", half, got)
+			}
+			continue
+		}
+		if got := float32ToFloat16(value); got != uint16(half) {
+			t.Errorf("%#04x is %v, converted back to %#04x", half, value, got)
+		}
+	}
+
+	for _, test := range []struct {
+		value    float32
+		expected uint16
+	}{
+		{1 + 1.0/2048, 0x3c00}, // tie to even
+		{1 + 3.0/2048, 0x3c02}, // tie to even
+		{65504, 0x7bff},        // largest
+		{65520, 0x7c00},        // rounded to infinity
+		{1.0 / (1 << 24), 0x0001},
+		{1.0 / (1 << 25), 0x0000}, // tie to even
+		{1.5 / (1 << 25), 0x0001},
+		{float32(math.Copysign(0, -1)), 0x8000},
+	} {
+		if got := float32ToFloat16(test.value); got != test.expected {
+			t.Errorf("expected %v converted to %#04x, got %#04x", test.value, test.expected, got)
+		}
+	}
+
+	// the nearest half is chosen
+	rng := rand.New(rand.NewSource(23))
+	for i := 0; i < 100000; i++ {
+		value := float32(rng.NormFloat64() * math.Pow(2, float64(rng.Intn(40)-25)))
+		half := float32ToFloat16(value)
+		if half&0x7fff >= 0x7bff {
+			continue
+		}
+		err := math.Abs(float64(value - float16ToFloat32(half)))
+		for _, neighbor := range []uint16{half - 1, half + 1} {
+			if neighbor&0x7fff < 0x7c00 && math.Abs(float64(value-float16ToFloat32(neighbor))) < err {
+				t.Fatalf("%v converted to %v, %v is nearer", value, float16ToFloat32(half), float16ToFloat32(neighbor))
+			}
+		}
+	}
+}
+
+func TestBFloat16(t *testing.T) {
+	for half := 0; half <= math.MaxUint16; half++ {
+		value := bfloat16ToFloat32(uint16(half))
+		got := float32ToBFloat16(value)
+		if value != value {
+			if converted := bfloat16ToFloat32(got); converted == converted {
+				t.Errorf("NaN %#04x converted to %v", half, converted)
+			}
+			continue
+		}
+		if got != uint16(half) {
+			t.Errorf("%#04x is %v, converted back to %#04x", half, value, got)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(24))
+	for i := 0; i < 100000; i++ {
+		value := float32(rng.NormFloat64() * math.Pow(2, float64(rng.Intn(200)-100)))
+		half := float32ToBFloat16(value)
+		err := math.Abs(float64(value - bfloat16ToFloat32(half)))
+		for _, neighbor := range []uint16{half - 1, half + 1} {
+			if math.Abs(float64(value-bfloat16ToFloat32(neighbor))) < err {
+				t.Fatalf("%v converted to %v, %v is nearer", value, bfloat16ToFloat32(half), bfloat16ToFloat32(neighbor))
+			}
+		}
+	}
+}
+
+func TestHNSW_Float16(t *testing.T) {
+	const dim = 32
+
+	rng := rand.New(rand.NewSource(25))
+	vectors := randomVectors(rng, 2000, dim)
+	queries := randomVectors(rng, 50, dim)
+
+	for _, quantization := range []string{QuantizationFloat16, QuantizationBFloat16} {
+		h := NewHNSW(HNSWOption{
+			M:              16,
+			EfConstruction: 100,
+			EfSearch:       50,
+			VectorDim:      dim,
+			Quantization:   quantization,
+
+			RNG: rand.New(rand.NewSource(26)),
+		})
+		// accepted as float32, nothing to train
+		ids, err := h.AddVectors(vectors, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := len(h.codes.get(0)); size != 2*dim {
+			t.Errorf("%s: expected %d bytes code, got %d", quantization, 2*dim, size)
+		}
+
+		if recall := recallAt(h, vectors, ids, queries, 10); recall < 0.95 {
+			t.Errorf("%s: expected recall@10 at least 0.95, got %v", quantization, recall)
+		}
+
+		resultIDs, distances, _ := h.Search(queries[0], 1)
+		exact := h.distanceComputerFunc.CalcDistance(queries[0], vectors[resultIDs[0]])
+		if math.Abs(float64(distances[0]-exact)) > 0.01*float64(exact) {
+			t.Errorf("%s: expected distance near %v, got %v", quantization, exact, distances[0])
+		}
+
+		path := filepath.Join(t.TempDir(), "index.db")
+		if err := h.SaveToDisk(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadFromDisk(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, query := range queries[:10] {
+			expectedIDs, expectedDistances, _ := h.Search(query, 10)
+			gotIDs, gotDistances, _ := loaded.Search(query, 10)
+			if !slices.Equal(expectedIDs, gotIDs) || !slices.Equal(expectedDistances, gotDistances) {
+				t.Fatalf("%s: search differs after loading\n%v %v\n%v %v", quantization, expectedIDs, expectedDistances, gotIDs, gotDistances)
+			}
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package hnsw
 
 import (
-	"container/heap"
 	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
-	"os"
+	"runtime"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -20,14 +20,40 @@ const defaultVectorDim = 128
 
 const defaultSize = 1000
 
-type HNSWOption struct {
+// GenericHNSWOption is the option of NewGenericHNSW
+type GenericHNSWOption[T Element] struct {
 	M                int
+	M0               int // max neighbors on level 0, default is 2*M
 	EfConstruction   int
 	EfSearch         int
 	MaxLevel         int
 	VectorDim        int
-	DistanceComputer distanceComputer
-	NormalizeVector  bool
+	DistanceComputer GenericDistanceComputer[T]
+	NormalizeVector  bool // normalize the vectors and the queries to unit length, for CosineDistance and InnerProductDistance. Only for float element
+
+	// NeighborHeuristic select neighbors using the heuristic from the HNSW paper (algorithm 4)
+	// instead of simply keeping the M closest candidates.
+	// A candidate is kept only when it's closer to the base node than to any already selected neighbor
+	NeighborHeuristic bool
+	// ExtendCandidates extend the candidates with their own neighbors, only used by the heuristic
+	ExtendCandidates bool
+	// KeepPrunedConnections fill up the neighbors with the pruned candidates until M, only used by the heuristic
+	KeepPrunedConnections bool
+
+	// Quantization store the vectors compressed, see QuantizationSQ8, QuantizationPQ, QuantizationBinary,
+	// QuantizationFloat16 and QuantizationBFloat16. The graph is built and searched on the codes,
+	// so the distances are approximate. Train must be called before adding vectors, except for
+	// QuantizationBinary, QuantizationFloat16 and QuantizationBFloat16
+	Quantization string
+	// PQSubquantizers is the number of sub vectors of QuantizationPQ, VectorDim must be divisible by it.
+	// Default is VectorDim/4
+	PQSubquantizers int
+	// PQBits is the number of bits of every sub vector code of QuantizationPQ, from 1 to 8. Default is 8
+	PQBits int
+	// RerankFactor keeps the float32 vectors in memory next to the codes when > 0, the search oversamples
+	// TopK*RerankFactor nearest nodes on the codes and reranks them with the exact distance.
+	// It's only used with Quantization
+	RerankFactor int
 
 	// graph size, this is not hard limit as Go will grow the slice
 	// but it is a good idea to set it to a reasonable value
@@ -37,41 +63,115 @@ type HNSWOption struct {
 	RNG RNGMachine // Optional, if not set, will use default rand source
 }
 
-type HNSW struct {
+// HNSWOption is the option of NewHNSW
+type HNSWOption = GenericHNSWOption[float32]
+
+// GenericHNSW is HNSW storing vectors of T as is, so uint8 and float64 vectors don't need converting to float32.
+// The distance must be a GenericDistanceComputer of T like GenericL2Distance.
+// Quantization is only available for float32
+type GenericHNSW[T Element] struct {
 	M               int
+	M0              int
 	MaxLevel        int
 	vectorDim       int
 	size            int
 	normalizeVector bool
 
+	neighborHeuristic     bool
+	extendCandidates      bool
+	keepPrunedConnections bool
+
 	curMaxLevel int
 	entryPoint  int
 
-	distanceComputerFunc distanceComputer
+	distanceComputerFunc GenericDistanceComputer[T]
 
 	EfConstruction int
-	EfSearch       int
+	// EfSearch is the default for every Search, it must not be changed while searching.
+	// Use SearchOptions.EfSearch to change it per query
+	EfSearch int
 
 	mL  float64 // mL = 1 / log(M)
 	rng RNGMachine
 
-	vectors [][]float32 // Vectors in the graph
-	nodes   []*Node     // Nodes in the graph
-
-	writeLock sync.Mutex
+	vectors *vectorArena[T]        // Vectors in the graph, nil when quantized without rerank
+	nodes   *segmentedSlice[*Node] // Nodes in the graph
+
+	quantization string
+	quantizer    quantizer[T]       // nil when not quantized
+	codes        *vectorArena[byte] // quantized vectors of quantizer.codeSize() bytes, nil when not quantized
+	rerankFactor int
+
+	deletedCount int // number of deleted nodes, guarded by lock
+
+	// inLinksBuilt is set by the first Delete or Update, until then the nodes have no inLinks
+	// so indexes that are never modified don't pay for them. Guarded by lock
+	inLinksBuilt bool
+
+	// lock guards the graph, Search and AddVector take the read lock
+	// while Update, Delete, PrintGraph and SaveToDisk take the write lock to have the graph for themselves.
+	// Concurrent AddVector are synchronized by the finer locks below and the per node lock
+	lock sync.RWMutex
+	// growLock serializes ID allocation and rng
+	growLock sync.Mutex
+	// entryLock guards entryPoint and curMaxLevel
+	entryLock sync.Mutex
+	// promoteLock is held for the whole insertion of node higher than curMaxLevel,
+	// so concurrent promotion link their upper levels to each other
+	promoteLock sync.Mutex
+
+	searchPool sync.Pool // *searchBuffer
 }
 
+// HNSW is safe for concurrent use.
+// Any number of Search and AddVector can run at the same time,
+// while Update and Delete wait for them and block new ones until they are done
+type HNSW = GenericHNSW[float32]
+
 type Node struct {
 	ID                int
-	PerLevelNeighbors [][]int // Neighbors per level
+	PerLevelNeighbors [][]int32 // Neighbors per level, int32 halves the memory of the graph
 	MaxLevel          int
+	Deleted           bool // Deleted node is kept as tombstone, so the ID is not reused
+
+	// linked is set once insertNode is done. AddVectors takes the read lock per node,
+	// so Delete, Update and SaveToDisk may see allocated nodes that are not linked yet
+	linked bool
+
+	// lock guards PerLevelNeighbors. The neighbor list is replaced instead of modified in place,
+	// so reader only needs the read lock to get the list, searches don't wait for each other
+	lock sync.RWMutex
+
+	// inLinks are the nodes having this node as neighbor per level, so Delete and Update
+	// don't need to scan the graph. It's nil until the first Delete or Update builds it and not saved.
+	// inLinksLock may be taken while holding lock of any node, but no other lock is taken while holding it
+	inLinks     [][]int32
+	inLinksLock sync.Mutex
 }
 
 // NewHNSW creates a new HNSW graph with the given options
 func NewHNSW(option HNSWOption) *HNSW {
+	return NewGenericHNSW(option)
+}
+
+// NewGenericHNSW creates a new HNSW graph of T vectors, the default distance is GenericL2Distance.
+// It panics when NormalizeVector is set for integer T or Quantization for T other than float32,
+// or when the quantization options are invalid. NewIndex returns the error instead
+func NewGenericHNSW[T Element](option GenericHNSWOption[T]) *GenericHNSW[T] {
+	h, err := newGenericHNSW(option)
+	if err != nil {
+		panic("NewHNSW : " + err.Error())
+	}
+	return h
+}
+
+func newGenericHNSW[T Element](option GenericHNSWOption[T]) (*GenericHNSW[T], error) {
 	if option.M == 0 {
 		option.M = defaultM
 	}
+	if option.M0 == 0 {
+		option.M0 = 2 * option.M
+	}
 	if option.EfConstruction == 0 {
 		option.EfConstruction = defaultEfConstruction
 	}
@@ -88,11 +188,15 @@ func NewHNSW(option HNSWOption) *HNSW {
 		option.Size = defaultSize
 	}
 
-	distanceComputerFunc := distanceComputer(&L2Distance{})
+	distanceComputerFunc := defaultDistance[T]()
 	if option.DistanceComputer != nil {
 		distanceComputerFunc = option.DistanceComputer
 	}
 
+	if option.NormalizeVector && !isFloat[T]() {
+		return nil, fmt.Errorf("can't normalize %s vectors", elementType[T]())
+	}
+
 	// Seed the random number generator ONCE
 	source := rand.NewSource(time.Now().UnixNano())
 	rng := RNGMachine(rand.New(source))
@@ -104,23 +208,51 @@ func NewHNSW(option HNSWOption) *HNSW {
 	// Pre-calculate mL
 	mL := 1.0 / math.Log(float64(option.M))
 
-	return &HNSW{
+	quantizer, err := newQuantizer(option, distanceComputerFunc)
+	if err == nil && quantizer != nil {
+		err = quantizer.validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := &GenericHNSW[T]{
 		M:                    option.M,
+		M0:                   option.M0,
 		EfConstruction:       option.EfConstruction,
 		EfSearch:             option.EfSearch,
 		size:                 option.Size,
 		MaxLevel:             option.MaxLevel,
 		vectorDim:            option.VectorDim,
+		normalizeVector:      option.NormalizeVector,
 		distanceComputerFunc: distanceComputerFunc,
 		curMaxLevel:          0,
+		entryPoint:           -1,
 		rng:                  rng,
 		mL:                   mL,
-		vectors:              make([][]float32, 0, option.Size),
-		nodes:                make([]*Node, 0, option.Size),
+		nodes:                newSegmentedSlice[*Node](option.Size),
+
+		neighborHeuristic:     option.NeighborHeuristic,
+		extendCandidates:      option.ExtendCandidates,
+		keepPrunedConnections: option.KeepPrunedConnections,
+
+		quantization: option.Quantization,
+		quantizer:    quantizer,
+		rerankFactor: option.RerankFactor,
+	}
+
+	// the float32 vectors are only needed for reranking once quantized
+	if quantizer == nil || option.RerankFactor > 0 {
+		h.vectors = newVectorArena[T](option.Size, option.VectorDim)
+	}
+	if quantizer != nil {
+		h.codes = newVectorArena[byte](option.Size, quantizer.codeSize())
 	}
+
+	return h, nil
 }
 
-func (h *HNSW) AddVector(vector []float32) (id int, err error) {
+func (h *GenericHNSW[T]) AddVector(vector []T) (id int, err error) {
 
 	// can't add if dimension is different
 	if len(vector) != h.vectorDim {
@@ -132,205 +264,578 @@ func (h *HNSW) AddVector(vector []float32) (id int, err error) {
 		vector = normalize(vector)
 	}
 
-	maxLevel := h.genRandomMaxLevel()
+	h.lock.RLock()
+	defer h.lock.RUnlock()
 
-	newNode := &Node{
-		MaxLevel: maxLevel,
+	if h.quantizer != nil && !h.quantizer.trained() {
+		return 0, fmt.Errorf("AddVector : the quantizer is not trained, call Train first")
 	}
 
-	h.writeLock.Lock()
-	defer h.writeLock.Unlock()
+	newNodes, err := h.allocateNodes([][]T{vector})
+	if err != nil {
+		return 0, fmt.Errorf("AddVector : %w", err)
+	}
+	newNode := newNodes[0]
+	h.insertNode(newNode, vector)
 
-	newNode.ID = len(h.nodes)
-	h.vectors = append(h.vectors, vector)
-	h.nodes = append(h.nodes, newNode)
+	return newNode.ID, nil
+}
 
-	// initialize the neighbors array
-	for i := 0; i <= maxLevel; i++ {
-		newNode.PerLevelNeighbors = append(newNode.PerLevelNeighbors, []int{})
+// AddVectors add the vectors using multiple goroutines, workers <= 0 means GOMAXPROCS.
+// The returned IDs are contiguous and follow the order of vectors.
+// All vectors are validated before inserting, so nothing is added on error
+func (h *GenericHNSW[T]) AddVectors(vectors [][]T, workers int) (ids []int, err error) {
+	for _, vector := range vectors {
+		if len(vector) != h.vectorDim {
+			err = fmt.Errorf("AddVectors : Different vector dimension. Got %d expected %d", len(vector), h.vectorDim)
+			return nil, err
+		}
 	}
 
-	// for first node, set entry point
-	if len(h.nodes) == 1 {
-		h.entryPoint = newNode.ID
-		h.curMaxLevel = maxLevel
+	if h.normalizeVector {
+		normalized := make([][]T, 0, len(vectors))
+		for _, vector := range vectors {
+			normalized = append(normalized, normalize(vector))
+		}
+		vectors = normalized
+	}
 
-		return newNode.ID, nil
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
 	}
 
-	// search top level
-	var candidateNodeID = []int{h.entryPoint}
-	var candidateDistance = []float32{0}
+	newNodes, err := h.allocateBatch(vectors)
+	if err != nil {
+		return nil, err
+	}
 
-	// search next level until 0
-	for l := h.curMaxLevel - 1; l >= 0; l-- {
-		// when level higher than nodeMaxlevel, topK is 1
-		if l > maxLevel {
-			candidateNodeID, candidateDistance = h.searchLevel(vector, candidateNodeID, candidateDistance, l, 1)
-		} else {
-			candidateNodeID, candidateDistance = h.searchLevel(vector, candidateNodeID, candidateDistance, l, h.EfConstruction)
-			// add candidate as neighboor on this level
-			upperbound := h.M
-			if len(candidateNodeID) < h.M {
-				upperbound = len(candidateNodeID)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				// locked per node, so a waiting Delete doesn't block Search until the whole batch is done
+				h.lock.RLock()
+				h.insertNode(newNodes[idx], vectors[idx])
+				h.lock.RUnlock()
 			}
-			newNode.PerLevelNeighbors[l] = append(newNode.PerLevelNeighbors[l], candidateNodeID[:upperbound]...)
+		}()
+	}
 
-			// try to link the neighbors
-			h.linkNeighborNodes(newNode.ID, candidateNodeID, l)
-		}
+	for idx := range vectors {
+		jobs <- idx
 	}
+	close(jobs)
+	wg.Wait()
 
-	// set current max level of graph to the just added node if higher and set new entry point
-	if h.curMaxLevel < maxLevel {
-		h.curMaxLevel = maxLevel
-		h.entryPoint = newNode.ID
+	ids = make([]int, 0, len(newNodes))
+	for _, node := range newNodes {
+		ids = append(ids, node.ID)
 	}
 
-	return newNode.ID, nil
+	return ids, nil
 }
 
-// genRandomMaxLevel generate random max level. formula l = floor(-log(uniform(0,1)) * mL)
-func (h *HNSW) genRandomMaxLevel() int {
-	uniform := h.rng.Float64()
+// allocateBatch allocate the nodes of AddVectors
+func (h *GenericHNSW[T]) allocateBatch(vectors [][]T) ([]*Node, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
 
-	return int(math.Floor(-math.Log(uniform) * h.mL))
-}
+	if h.quantizer != nil && !h.quantizer.trained() {
+		return nil, fmt.Errorf("AddVectors : the quantizer is not trained, call Train first")
+	}
 
-func (h *HNSW) searchLevelInternal(vectorToSearch []float32, entrypointNode []int, distanceToEntrypoint []float32, level int) (result priorityQueueMin) {
-	if len(entrypointNode) != len(distanceToEntrypoint) {
-		return
+	newNodes, err := h.allocateNodes(vectors)
+	if err != nil {
+		return nil, fmt.Errorf("AddVectors : %w", err)
 	}
 
-	visited := make(map[int]bool)
-	candidate := newPriorityQueueMax(h.EfConstruction)
-	result = newPriorityQueueMin(h.EfConstruction)
+	return newNodes, nil
+}
 
-	var farthestResult float32
+// allocateNodes add the nodes and their vectors to the graph without any link.
+// The node is not reachable until insertNode is called
+func (h *GenericHNSW[T]) allocateNodes(vectors [][]T) ([]*Node, error) {
+	h.growLock.Lock()
+	defer h.growLock.Unlock()
 
-	for idx := 0; idx < len(entrypointNode); idx++ {
-		heap.Push(&candidate, &pqItem{Value: entrypointNode[idx], Priority: distanceToEntrypoint[idx]})
+	// the neighbor lists store node ID as int32
+	if h.nodes.len()+len(vectors) > math.MaxInt32 {
+		return nil, fmt.Errorf("the index is full, it holds at most %d nodes", math.MaxInt32)
 	}
 
-	for candidate.Len() > 0 {
-		toVisit := heap.Pop(&candidate).(*pqItem)
+	newNodes := make([]*Node, 0, len(vectors))
+	for _, vector := range vectors {
+		// rng is not safe for concurrent use, so it's called within the lock
+		maxLevel := h.genRandomMaxLevel()
 
-		// skip visited node
-		if visited[toVisit.Value] {
-			continue
+		newNode := &Node{
+			ID:       h.nodes.len(),
+			MaxLevel: maxLevel,
 		}
 
-		// calculate the distance
-		// Distance is being used for the priority queue
-		if toVisit.Priority == 0 {
-			toVisit.Priority = h.distanceComputerFunc.CalcDistance(vectorToSearch, h.vectors[toVisit.Value])
+		// initialize the neighbors array
+		for i := 0; i <= maxLevel; i++ {
+			newNode.PerLevelNeighbors = append(newNode.PerLevelNeighbors, []int32{})
 		}
-
-		// update farthest result
-		if toVisit.Priority > farthestResult {
-			farthestResult = toVisit.Priority
+		if h.inLinksBuilt {
+			newNode.inLinks = make([][]int32, maxLevel+1)
 		}
 
-		// stop criteria : if the shortest candidate farther than the farthestResult, stop early.
-		if toVisit.Priority > farthestResult {
-			break
+		if h.vectors != nil {
+			h.vectors.append(vector)
 		}
-
-		// add to result
-		heap.Push(&result, toVisit)
-		visited[toVisit.Value] = true
-
-		// add neighboor as candidate
-		for _, nodeID := range h.nodes[toVisit.Value].PerLevelNeighbors[level] {
-			dist := h.distanceComputerFunc.CalcDistance(vectorToSearch, h.vectors[nodeID])
-			heap.Push(&candidate, &pqItem{Value: nodeID, Priority: dist})
+		// encoding is slow for PQ, so insertNode encodes outside the lock, the code is zero until then
+		if h.codes != nil {
+			h.codes.append(nil)
 		}
+		h.nodes.append(newNode)
+
+		newNodes = append(newNodes, newNode)
 	}
 
-	return
+	return newNodes, nil
 }
 
-// searchLevel search within defined level
-// the output is sorted by priority, closest is index 0
-func (h *HNSW) searchLevel(vectorToSearch []float32, entrypointNode []int, distanceToEntrypoint []float32, level int, topK int) (resultNodeID []int, resultDistance []float32) {
-	if len(entrypointNode) != len(distanceToEntrypoint) {
+// insertNode link the allocated node into the graph, it can be called concurrently
+// while holding the read lock
+func (h *GenericHNSW[T]) insertNode(newNode *Node, vector []T) {
+	defer func() { newNode.linked = true }()
+
+	// no one reads the code until the node is linked
+	if h.codes != nil {
+		h.codes.set(newNode.ID, h.quantizer.encode(vector))
+	}
+
+	entryPoint, curMaxLevel, first := h.initEntryPoint(newNode)
+	if first {
 		return
 	}
 
-	result := h.searchLevelInternal(vectorToSearch, entrypointNode, distanceToEntrypoint, level)
+	// the node will be the new entry point, hold promoteLock until it's linked
+	// and check again as another promotion may finish while waiting
+	if newNode.MaxLevel > curMaxLevel {
+		h.promoteLock.Lock()
+		defer h.promoteLock.Unlock()
 
-	// put topK nearest as result
-	for k := 0; k < topK; k++ {
-		if result.Len() == 0 {
-			break
+		entryPoint, curMaxLevel = h.getEntryPoint()
+	}
+
+	h.connectNode(newNode, vector, entryPoint, curMaxLevel)
+
+	// set current max level of graph to the just added node if higher and set new entry point
+	if newNode.MaxLevel > curMaxLevel {
+		h.setEntryPoint(newNode.ID, newNode.MaxLevel)
+	}
+}
+
+// initEntryPoint set the node as entry point when the graph has no entry point,
+// it happens for the first node and when every other node is deleted
+func (h *GenericHNSW[T]) initEntryPoint(node *Node) (entryPoint int, curMaxLevel int, first bool) {
+	h.entryLock.Lock()
+	defer h.entryLock.Unlock()
+
+	if h.entryPoint < 0 {
+		h.entryPoint = node.ID
+		h.curMaxLevel = node.MaxLevel
+		return h.entryPoint, h.curMaxLevel, true
+	}
+
+	return h.entryPoint, h.curMaxLevel, false
+}
+
+func (h *GenericHNSW[T]) getEntryPoint() (entryPoint int, curMaxLevel int) {
+	h.entryLock.Lock()
+	defer h.entryLock.Unlock()
+
+	return h.entryPoint, h.curMaxLevel
+}
+
+// setEntryPoint promote the node as entry point if it's higher than current max level
+func (h *GenericHNSW[T]) setEntryPoint(id int, maxLevel int) {
+	h.entryLock.Lock()
+	defer h.entryLock.Unlock()
+
+	if maxLevel > h.curMaxLevel {
+		h.curMaxLevel = maxLevel
+		h.entryPoint = id
+	}
+}
+
+func (h *GenericHNSW[T]) node(id int) *Node {
+	return h.nodes.get(id)
+}
+
+// vector return the stored vector, or a decoded copy when only the codes are kept
+func (h *GenericHNSW[T]) vector(id int) []T {
+	if h.vectors == nil {
+		return h.quantizer.decode(h.codes.get(id))
+	}
+	return h.vectors.get(id)
+}
+
+// neighbors return the neighbor list of the node on the level, the list must not be modified
+func (h *GenericHNSW[T]) neighbors(id int, level int) []int32 {
+	node := h.nodes.get(id)
+
+	node.lock.RLock()
+	defer node.lock.RUnlock()
+
+	return node.PerLevelNeighbors[level]
+}
+
+func (h *GenericHNSW[T]) setNeighbors(node *Node, level int, neighbors []int32) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	h.replaceNeighbors(node, level, neighbors)
+}
+
+// replaceNeighbors set the neighbor list and update the inLinks of the added and removed neighbors.
+// The caller must hold node.lock, so the changes of the same list are applied in order
+func (h *GenericHNSW[T]) replaceNeighbors(node *Node, level int, neighbors []int32) {
+	current := node.PerLevelNeighbors[level]
+	node.PerLevelNeighbors[level] = neighbors
+
+	if !h.inLinksBuilt {
+		return
+	}
+
+	for _, neighbor := range current {
+		if !containsNode(neighbors, int(neighbor)) {
+			h.removeInLink(int(neighbor), level, node.ID)
+		}
+	}
+	for _, neighbor := range neighbors {
+		if !containsNode(current, int(neighbor)) {
+			h.addInLink(int(neighbor), level, node.ID)
 		}
-		res := heap.Pop(&result).(*pqItem)
-		resultNodeID = append(resultNodeID, res.Value)
-		resultDistance = append(resultDistance, res.Priority)
 	}
+}
 
-	return
+func (h *GenericHNSW[T]) addInLink(id int, level int, from int) {
+	if !h.inLinksBuilt {
+		return
+	}
+
+	node := h.node(id)
+
+	node.inLinksLock.Lock()
+	defer node.inLinksLock.Unlock()
+
+	node.inLinks[level] = append(node.inLinks[level], int32(from))
+}
+
+func (h *GenericHNSW[T]) removeInLink(id int, level int, from int) {
+	node := h.node(id)
+
+	node.inLinksLock.Lock()
+	defer node.inLinksLock.Unlock()
+
+	inLinks := node.inLinks[level]
+	for i := range inLinks {
+		if int(inLinks[i]) == from {
+			inLinks[i] = inLinks[len(inLinks)-1]
+			node.inLinks[level] = inLinks[:len(inLinks)-1]
+			return
+		}
+	}
 }
 
-func (h *HNSW) Search(VecToSearch []float32, topK int) (resultNodeID []int, resultDistance []float32, err error) {
-	if len(VecToSearch) != h.vectorDim {
-		err = fmt.Errorf("AddVector : Different vector dimension. Got %d expected %d", len(VecToSearch), h.vectorDim)
+// buildInLinks set the inLinks of every node from the neighbor lists, the caller must hold the write lock.
+// Nodes allocated by AddVectors but not linked yet get empty inLinks, insertNode maintains them afterward
+func (h *GenericHNSW[T]) buildInLinks() {
+	if h.inLinksBuilt {
 		return
 	}
 
-	candidateNodeID := []int{h.entryPoint}
-	candidateDistance := []float32{0}
+	nodes := h.nodes.toSlice()
+	for _, node := range nodes {
+		node.inLinks = make([][]int32, len(node.PerLevelNeighbors))
+	}
+	for _, node := range nodes {
+		for level, neighbors := range node.PerLevelNeighbors {
+			for _, neighbor := range neighbors {
+				target := nodes[neighbor]
+				target.inLinks[level] = append(target.inLinks[level], int32(node.ID))
+			}
+		}
+	}
+	h.inLinksBuilt = true
+}
+
+// linkedFrom return a copy of the nodes having the node as neighbor on the level
+func (h *GenericHNSW[T]) linkedFrom(id int, level int) []int32 {
+	node := h.node(id)
+
+	node.inLinksLock.Lock()
+	defer node.inLinksLock.Unlock()
+
+	return slices.Clone(node.inLinks[level])
+}
+
+// connectNode search the node neighbors from the entry point down to level 0,
+// on every level the node lives on the selected neighbors are linked both ways.
+// The node neighbors are set on every level before linking, so when other goroutine
+// can reach the node, its neighbors are complete
+func (h *GenericHNSW[T]) connectNode(node *Node, vector []T, entryPoint int, curMaxLevel int) {
+	buf := h.getSearchBuffer()
+	defer h.putSearchBuffer(buf)
+
+	query := h.distanceFrom(vector)
+
+	// search top level
+	candidates := []pqItem{{Value: entryPoint, Priority: query.distance(entryPoint)}}
+
+	perLevelNeighbors := make([][]int32, node.MaxLevel+1)
 
-	// search next level until 0
-	for l := h.curMaxLevel - 1; l >= 0; l-- {
+	// search from the top level until 0
+	for l := curMaxLevel; l >= 0; l-- {
 		// when level higher than nodeMaxlevel, topK is 1
-		if l > 0 {
-			candidateNodeID, candidateDistance = h.searchLevel(VecToSearch, candidateNodeID, candidateDistance, l, 1)
+		if l > node.MaxLevel {
+			candidates = h.searchLevelInternal(buf, query, candidates, l, 1, nil)
 		} else {
-			candidateNodeID, candidateDistance = h.searchLevel(VecToSearch, candidateNodeID, candidateDistance, l, h.EfSearch)
+			candidates = h.searchLevelInternal(buf, query, candidates, l, h.EfConstruction, nil)
+
+			// the node itself can be found when it's already in the graph
+			others := make([]pqItem, 0, len(candidates))
+			for _, candidate := range candidates {
+				if candidate.Value != node.ID {
+					others = append(others, candidate)
+				}
+			}
+
+			// add selected candidate as neighboor on this level
+			neighbors := h.selectNeighbors(node.ID, others, h.maxNeighbors(l), l, h.extendCandidates)
+			perLevelNeighbors[l] = make([]int32, 0, len(neighbors))
+			for _, neighbor := range neighbors {
+				perLevelNeighbors[l] = append(perLevelNeighbors[l], int32(neighbor.Value))
+			}
 		}
 	}
 
-	if len(candidateNodeID) == 0 {
-		return
+	for l, neighbors := range perLevelNeighbors {
+		if neighbors != nil {
+			h.setNeighbors(node, l, neighbors)
+		}
 	}
 
-	offset := len(candidateNodeID)
-	if offset > topK {
-		offset = topK
+	// try to link the neighbors
+	for l, neighbors := range perLevelNeighbors {
+		h.linkNeighborNodes(node.ID, neighbors, l)
 	}
+}
 
-	resultNodeID = append(resultNodeID, candidateNodeID[:offset]...)
-	resultDistance = append(resultDistance, candidateDistance[:offset]...)
+// genRandomMaxLevel generate random max level. formula l = floor(-log(uniform(0,1)) * mL)
+func (h *GenericHNSW[T]) genRandomMaxLevel() int {
+	uniform := h.rng.Float64()
+
+	return int(math.Floor(-math.Log(uniform) * h.mL))
+}
+
+// searchLevelInternal is SEARCH-LAYER of the HNSW paper, it search the ef nearest nodes within the level.
+// The search expands the closest candidate until the closest candidate is farther
+// than the farthest of the ef results. The entry point priority must be the real distance.
+// when filter is not nil, node that doesn't match is still traversed but not added to the result,
+// so the search continues until ef matching nodes are found or the graph is exhausted.
+// the output is sorted by priority, closest is index 0.
+// When buf is stopped, the search returns the nearest nodes found so far.
+// The output is stored in buf and valid until the next search using buf,
+// entrypoints may be the previous output as they are read before the output is written
+func (h *GenericHNSW[T]) searchLevelInternal(buf *searchBuffer, query *nodeDistance[T], entrypoints []pqItem, level int, ef int, filter func(id int) bool) (result []pqItem) {
+	visited := &buf.visited
+	candidate := &buf.candidate
+	found := &buf.found // bounded to ef, farthest on top
+
+	visited.reset(h.nodes.len())
+	candidate.Reset()
+	found.Reset()
+
+	// counted locally and added to buf.stats at the end
+	var visitedCount, distanceCount, hops int
+
+	for _, entrypoint := range entrypoints {
+		if visited.visit(entrypoint.Value) {
+			continue
+		}
+		visitedCount++
+
+		candidate.Push(entrypoint)
+		if filter == nil || filter(entrypoint.Value) {
+			found.Push(entrypoint)
+			if found.Len() > ef {
+				found.Pop()
+			}
+		}
+	}
+
+	for candidate.Len() > 0 {
+		if buf.stopped() {
+			break
+		}
+
+		toVisit := candidate.Pop()
+
+		// stop criteria : the closest candidate is farther than the farthest result,
+		// expanding it can't improve the result anymore
+		if found.Len() >= ef && toVisit.Priority > found.Top().Priority {
+			break
+		}
+
+		hops++
+		if buf.explain {
+			buf.stats.Path = append(buf.stats.Path, SearchStep{Level: level, ID: toVisit.Value, Distance: toVisit.Priority})
+		}
+
+		// add neighboor as candidate
+		for _, neighbor := range h.neighbors(toVisit.Value, level) {
+			nodeID := int(neighbor)
+			if visited.visit(nodeID) {
+				continue
+			}
+			visitedCount++
+
+			// once found is full, only node nearer than the farthest result matters
+			var dist float32
+			if found.Len() >= ef {
+				dist = query.distanceBounded(nodeID, found.Top().Priority)
+			} else {
+				dist = query.distance(nodeID)
+			}
+			distanceCount++
+			if found.Len() >= ef && dist >= found.Top().Priority {
+				continue
+			}
+
+			item := pqItem{Value: nodeID, Priority: dist}
+			candidate.Push(item)
+			if filter == nil || filter(nodeID) {
+				found.Push(item)
+				if found.Len() > ef {
+					found.Pop()
+				}
+			}
+		}
+	}
+
+	if stats := buf.stats; stats != nil {
+		stats.VisitedPerLevel[level] += visitedCount
+		stats.DistanceComputations += distanceCount
+		stats.Hops += hops
+	}
+
+	// pop from farthest, fill from the back
+	result = slices.Grow(buf.result[:0], found.Len())[:found.Len()]
+	for idx := len(result) - 1; idx >= 0; idx-- {
+		result[idx] = found.Pop()
+	}
+	buf.result = result
+
+	return
+}
+
+// Search search the topK nearest nodes using EfSearch, see SearchWithOptions for per query parameters
+func (h *GenericHNSW[T]) Search(VecToSearch []T, topK int) (resultNodeID []int, resultDistance []float32, err error) {
+	return h.SearchWithFilter(VecToSearch, topK, nil)
+}
+
+// SearchWithFilter search the nearest nodes which match the filter.
+// Non matching nodes are still traversed, so the search continue until topK matching nodes are found
+// or the graph is exhausted. nil filter match every node.
+// filter is called while holding the read lock, it must not call AddVector, Update or Delete
+func (h *GenericHNSW[T]) SearchWithFilter(VecToSearch []T, topK int, filter func(id int) bool) (resultNodeID []int, resultDistance []float32, err error) {
+	results, err := h.SearchWithOptions(VecToSearch, SearchOptions{TopK: topK, Filter: filter})
+	if err != nil {
+		return
+	}
+
+	resultNodeID = make([]int, 0, len(results))
+	resultDistance = make([]float32, 0, len(results))
+	for _, result := range results {
+		resultNodeID = append(resultNodeID, result.ID)
+		resultDistance = append(resultDistance, result.Distance)
+	}
 
 	return
 }
 
 // linkNeighborNodes utility function to call linkNeighborNode
-func (h *HNSW) linkNeighborNodes(src int, dst []int, level int) {
+func (h *GenericHNSW[T]) linkNeighborNodes(src int, dst []int32, level int) {
 	if len(dst) <= 0 {
 		return
 	}
 
 	for idx := range dst {
-		h.linkNeighborNode(src, dst[idx], level)
+		h.linkNeighborNode(src, int(dst[idx]), level)
 	}
 }
 
 // linkNeighborNode try to add src node as dst neighbor
-// if dst neighbor >= M, we will try to find a place
+// if dst neighbor >= max neighbors of the level, we will try to find a place
 // by comparing if src distance farther then the farthest neighbor of dst
-func (h *HNSW) linkNeighborNode(src int, dst int, level int) {
-	neighborsCandidate := make([]pqItem, 0, h.M+1)
+func (h *GenericHNSW[T]) linkNeighborNode(src int, dst int, level int) {
+	dstNode := h.node(dst)
+
+	dstNode.lock.Lock()
+	defer dstNode.lock.Unlock()
+
+	currentNeighbors := dstNode.PerLevelNeighbors[level]
+
+	// already linked
+	if containsNode(currentNeighbors, src) {
+		return
+	}
+
+	maxNeighbors := h.maxNeighbors(level)
+
+	// there is still a place, no need to compare
+	if len(currentNeighbors) < maxNeighbors {
+		neighbors := make([]int32, 0, len(currentNeighbors)+1)
+		neighbors = append(neighbors, currentNeighbors...)
+		dstNode.PerLevelNeighbors[level] = append(neighbors, int32(src))
+		h.addInLink(src, level, dst)
+		return
+	}
+
+	neighborsCandidate := make([]pqItem, 0, maxNeighbors+1)
 
-	distance := h.distanceComputerFunc.CalcDistance(h.vectors[src], h.vectors[dst])
-	neighborsCandidate = append(neighborsCandidate, pqItem{Value: src, Priority: distance})
+	dstDistance := h.distanceFromNode(dst)
+	srcDistance := dstDistance.distance(src)
+	neighborsCandidate = append(neighborsCandidate, pqItem{Value: src, Priority: srcDistance})
 
-	for _, neighborID := range h.nodes[dst].PerLevelNeighbors[level] {
-		distance := h.distanceComputerFunc.CalcDistance(h.vectors[neighborID], h.vectors[dst])
+	// simple selection drop the farthest, so src only gets in when a neighbor is farther than src.
+	// The neighbors distance can be bounded by src distance, only the farther ones need the exact distance
+	isBounded := dstDistance.bounded != nil && !h.neighborHeuristic
+
+	farther := false
+	for _, neighbor := range currentNeighbors {
+		neighborID := int(neighbor)
+		var distance float32
+		if isBounded {
+			distance = dstDistance.distanceBounded(neighborID, srcDistance)
+		} else {
+			distance = dstDistance.distance(neighborID)
+		}
+		farther = farther || distance > srcDistance
 		neighborsCandidate = append(neighborsCandidate, pqItem{Value: neighborID, Priority: distance})
 	}
 
+	if isBounded {
+		// src is the farthest, nothing changes
+		if !farther {
+			return
+		}
+
+		for i := range neighborsCandidate {
+			if neighborsCandidate[i].Priority > srcDistance {
+				neighborsCandidate[i].Priority = dstDistance.distance(neighborsCandidate[i].Value)
+			}
+		}
+	}
+
 	// rebuild the neighbor
 
 	// sort ascending
@@ -338,21 +843,123 @@ func (h *HNSW) linkNeighborNode(src int, dst int, level int) {
 		return neighborsCandidate[i].Priority < neighborsCandidate[j].Priority
 	})
 
-	h.nodes[dst].PerLevelNeighbors[level] = make([]int, 0, h.M) // reset
+	// the candidates are not extended here,
+	// it would read other neighbor list while holding the lock of dst
+	neighborsCandidate = h.selectNeighbors(dst, neighborsCandidate, maxNeighbors, level, false)
 
-	upperBound := len(neighborsCandidate)
-	if upperBound > h.M {
-		upperBound = h.M
+	neighbors := make([]int32, 0, maxNeighbors)
+	for i := range neighborsCandidate {
+		neighbors = append(neighbors, int32(neighborsCandidate[i].Value))
 	}
+	h.replaceNeighbors(dstNode, level, neighbors)
+}
+
+// maxNeighbors return the max degree of the level, level 0 has M0 and the rest has M
+func (h *GenericHNSW[T]) maxNeighbors(level int) int {
+	if level == 0 {
+		return h.M0
+	}
+	return h.M
+}
 
-	for i := 0; i < upperBound; i++ {
-		h.nodes[dst].PerLevelNeighbors[level] = append(h.nodes[dst].PerLevelNeighbors[level], neighborsCandidate[i].Value)
+// selectNeighbors select at most m neighbors of base node from candidates.
+// candidates must be sorted ascending by distance to the base node, the output keeps the order.
+// extend is only used by the heuristic, see ExtendCandidates option
+func (h *GenericHNSW[T]) selectNeighbors(base int, candidates []pqItem, m int, level int, extend bool) []pqItem {
+	if !h.neighborHeuristic {
+		if len(candidates) > m {
+			candidates = candidates[:m]
+		}
+		return candidates
 	}
+
+	return h.selectNeighborsHeuristic(base, candidates, m, level, extend)
+}
+
+// selectNeighborsHeuristic is algorithm 4 of the HNSW paper.
+// candidate is selected only when it's closer to the base node than to any selected neighbor,
+// this keeps the graph connected between clusters instead of linking only within the cluster
+func (h *GenericHNSW[T]) selectNeighborsHeuristic(base int, candidates []pqItem, m int, level int, extend bool) []pqItem {
+	working := candidates
+
+	if extend {
+		baseDistance := h.distanceFromNode(base)
+
+		seen := make(map[int]bool, len(candidates))
+		seen[base] = true
+		for _, candidate := range candidates {
+			seen[candidate.Value] = true
+		}
+
+		working = make([]pqItem, 0, len(candidates)*2)
+		working = append(working, candidates...)
+		for _, candidate := range candidates {
+			for _, neighbor := range h.neighbors(candidate.Value, level) {
+				neighborID := int(neighbor)
+				if seen[neighborID] {
+					continue
+				}
+				seen[neighborID] = true
+
+				distance := baseDistance.distance(neighborID)
+				working = append(working, pqItem{Value: neighborID, Priority: distance})
+			}
+		}
+
+		sort.Slice(working, func(i, j int) bool {
+			return working[i].Priority < working[j].Priority
+		})
+	}
+
+	result := make([]pqItem, 0, m)
+	var discarded []pqItem
+
+	for _, candidate := range working {
+		if len(result) >= m {
+			break
+		}
+
+		good := true
+		candidateDistance := h.distanceFromNode(candidate.Value)
+		for _, selected := range result {
+			distance := candidateDistance.distance(selected.Value)
+			if distance < candidate.Priority {
+				good = false
+				break
+			}
+		}
+
+		if good {
+			result = append(result, candidate)
+		} else {
+			discarded = append(discarded, candidate)
+		}
+	}
+
+	if h.keepPrunedConnections {
+		for _, candidate := range discarded {
+			if len(result) >= m {
+				break
+			}
+			result = append(result, candidate)
+		}
+	}
+
+	return result
 }
 
 // Function to pretty print the HNSW graph
-func (h *HNSW) PrintGraph() {
-	if h == nil || len(h.nodes) == 0 {
+func (h *GenericHNSW[T]) PrintGraph() {
+	if h == nil {
+		fmt.Println("Graph is empty or not initialized.")
+		return
+	}
+
+	// write lock so the neighbor lists don't change while printing
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.nodes.len() == 0 {
 		fmt.Println("Graph is empty or not initialized.")
 		return
 	}
@@ -366,7 +973,7 @@ func (h *HNSW) PrintGraph() {
 		foundNodesAtLevel := false
 
 		// Iterate through all nodes in the graph
-		for _, node := range h.nodes {
+		for _, node := range h.nodes.toSlice() {
 			if node == nil {
 				continue // Skip nil nodes if any (should ideally not happen in a well-managed graph)
 			}
@@ -407,12 +1014,15 @@ func (h *HNSW) PrintGraph() {
 	fmt.Println("\n===================================================")
 }
 
-func (H *HNSW) toDiskFormat() *HNSWOnDisk {
-	onDisk := &HNSWOnDisk{
+func (H *GenericHNSW[T]) toDiskFormat() (*GenericHNSWOnDisk[T], error) {
+	onDisk := &GenericHNSWOnDisk[T]{
+		IndexType:       IndexTypeHNSW,
+		ElementType:     elementType[T](),
 		M:               H.M,
+		M0:              H.M0,
 		MaxLevel:        H.MaxLevel,
 		VectorDim:       H.vectorDim,
-		Size:            len(H.nodes),
+		Size:            H.nodes.len(),
 		NormalizeVector: H.normalizeVector,
 
 		CurMaxLevel: H.curMaxLevel,
@@ -421,44 +1031,79 @@ func (H *HNSW) toDiskFormat() *HNSWOnDisk {
 		EfConstruction: H.EfConstruction,
 		EfSearch:       H.EfSearch,
 
+		NeighborHeuristic:     H.neighborHeuristic,
+		ExtendCandidates:      H.extendCandidates,
+		KeepPrunedConnections: H.keepPrunedConnections,
+
 		ML:                   H.mL,
 		RNGMachine:           "default",
 		DistanceComputerFunc: H.distanceComputerFunc.GetName(),
 
-		Vectors: H.vectors,
-		Nodes:   H.nodes,
+		Nodes: H.nodes.toSlice(),
+
+		Quantization: H.quantization,
+		RerankFactor: H.rerankFactor,
+	}
+
+	// the nodes AddVectors hasn't linked yet are saved as deleted, as if they were never added
+	for idx, node := range onDisk.Nodes {
+		if !node.linked {
+			onDisk.Nodes[idx] = &Node{ID: node.ID, PerLevelNeighbors: node.PerLevelNeighbors, MaxLevel: node.MaxLevel, Deleted: true}
+		}
+	}
+
+	if H.vectors != nil {
+		onDisk.Vectors = H.vectors.toSlice()
+	}
+
+	if H.quantizer != nil {
+		quantizer, err := json.Marshal(H.quantizer)
+		if err != nil {
+			return nil, err
+		}
+		onDisk.Quantizer = quantizer
+		onDisk.Codes = H.codes.toSlice()
 	}
 
-	return onDisk
+	return onDisk, nil
 }
 
-func (H *HNSW) SaveToDisk(filepath string) error {
-	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY, 0644)
+func (H *GenericHNSW[T]) SaveToDisk(filepath string) error {
+	json, err := H.marshal()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	onDisk := H.toDiskFormat()
+	return writeFile(filepath, json)
+}
+
+// marshal hold the write lock so the graph doesn't change while saving
+func (H *GenericHNSW[T]) marshal() ([]byte, error) {
+	H.lock.Lock()
+	defer H.lock.Unlock()
 
-	json, err := json.Marshal(onDisk)
+	onDisk, err := H.toDiskFormat()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = file.Write(json)
-
-	return err
+	return json.Marshal(onDisk)
 }
 
-func normalize(vector []float32) []float32 {
-	var norm float32
+// normalize return a unit length copy of the vector, zero vector is copied as is.
+// T must be float, integer can't hold the unit vector
+func normalize[T Element](vector []T) []T {
+	var norm T
 	for i := range vector {
 		norm += vector[i] * vector[i]
 	}
-	norm = float32(math.Sqrt(float64(norm)))
+	norm = T(math.Sqrt(float64(norm)))
+
+	if norm == 0 {
+		return append([]T(nil), vector...)
+	}
 
-	result := make([]float32, 0, len(vector))
+	result := make([]T, 0, len(vector))
 	for i := range vector {
 		result = append(result, vector[i]/norm)
 	}
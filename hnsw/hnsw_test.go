@@ -1,7 +1,11 @@
 package hnsw
 
 import (
-	"container/heap"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 )
 
@@ -10,6 +14,7 @@ const staticRNG = 0.03
 func TestHNSW_linkNeighborNode(t *testing.T) {
 	tree := NewHNSW(HNSWOption{
 		M:              5,
+		M0:             5,
 		EfConstruction: 5,
 		EfSearch:       5,
 		MaxLevel:       5,
@@ -27,12 +32,12 @@ func TestHNSW_linkNeighborNode(t *testing.T) {
 	id7, _ := tree.AddVector([]float32{1, 6})
 
 	// reset the M of the node 1
-	tree.nodes[id1].PerLevelNeighbors[0] = make([]int, 0)
+	tree.node(id1).PerLevelNeighbors[0] = make([]int32, 0)
 
 	tree.linkNeighborNode(id2, id1, 0)
 
-	if len(tree.nodes[id1].PerLevelNeighbors[0]) != 1 {
-		t.Errorf("expected 1 neighbor, got %d", len(tree.nodes[id1].PerLevelNeighbors[0]))
+	if len(tree.node(id1).PerLevelNeighbors[0]) != 1 {
+		t.Errorf("expected 1 neighbor, got %d", len(tree.node(id1).PerLevelNeighbors[0]))
 	}
 
 	tree.linkNeighborNode(id3, id1, 0)
@@ -41,16 +46,16 @@ func TestHNSW_linkNeighborNode(t *testing.T) {
 	tree.linkNeighborNode(id6, id1, 0)
 	tree.linkNeighborNode(id7, id1, 0)
 
-	if len(tree.nodes[id1].PerLevelNeighbors[0]) != tree.M {
-		t.Errorf("expected %d neighbor, got %d", tree.M, len(tree.nodes[id1].PerLevelNeighbors[0]))
+	if len(tree.node(id1).PerLevelNeighbors[0]) != tree.M {
+		t.Errorf("expected %d neighbor, got %d", tree.M, len(tree.node(id1).PerLevelNeighbors[0]))
 	}
 
 	// Check only nearest neighboor is linked
 	// id6 is farthest
 	expectedM := []int{id2, id3, id4, id5, id7}
-	for idx := range tree.nodes[id1].PerLevelNeighbors[0] {
-		if tree.nodes[id1].PerLevelNeighbors[0][idx] != expectedM[idx] {
-			t.Errorf("expected %d neighbor id, got %d. idx %d", expectedM[idx], tree.nodes[id1].PerLevelNeighbors[0][idx], idx)
+	for idx := range tree.node(id1).PerLevelNeighbors[0] {
+		if int(tree.node(id1).PerLevelNeighbors[0][idx]) != expectedM[idx] {
+			t.Errorf("expected %d neighbor id, got %d. idx %d", expectedM[idx], tree.node(id1).PerLevelNeighbors[0][idx], idx)
 		}
 	}
 }
@@ -84,7 +89,7 @@ func BenchmarkHNSW_linkNeighborNode(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		// Reset neighbors before each run
-		tree.nodes[idBase].PerLevelNeighbors[0] = make([]int, 0)
+		tree.node(idBase).PerLevelNeighbors[0] = make([]int32, 0)
 		for j := 0; j < numCandidates; j++ {
 			tree.linkNeighborNode(candidateIDs[j], idBase, 0)
 		}
@@ -110,28 +115,26 @@ func TestHNSW_searchLevelInternal(t *testing.T) {
 
 	// Manually set neighbors for level 0: each node connects to previous and next (like a chain)
 	for i := 0; i < 10; i++ {
-		neighbors := []int{}
+		neighbors := []int32{}
 		if i > 0 {
-			neighbors = append(neighbors, ids[i-1])
+			neighbors = append(neighbors, int32(ids[i-1]))
 		}
 		if i < 9 {
-			neighbors = append(neighbors, ids[i+1])
+			neighbors = append(neighbors, int32(ids[i+1]))
 		}
-		h.nodes[ids[i]].PerLevelNeighbors[0] = neighbors
+		h.node(ids[i]).PerLevelNeighbors[0] = neighbors
 	}
 
 	// Search from node 0 at level 0
 	vectorToSearch := []float32{0, 0}
-	entrypointNode := []int{ids[0]}
-	distanceToEntrypoint := []float32{0}
+	entrypoints := []pqItem{{Value: ids[0], Priority: 0}}
 	level := 0
 
-	result := h.searchLevelInternal(vectorToSearch, entrypointNode, distanceToEntrypoint, level)
+	result := h.searchLevelInternal(h.getSearchBuffer(), h.distanceFrom(vectorToSearch), entrypoints, level, h.EfSearch, nil)
 
 	// Collect results
 	var gotIDs []int
-	for result.Len() > 0 {
-		item := heap.Pop(&result).(*pqItem)
+	for _, item := range result {
 		gotIDs = append(gotIDs, item.Value)
 	}
 
@@ -146,3 +149,373 @@ func TestHNSW_searchLevelInternal(t *testing.T) {
 		}
 	}
 }
+
+func TestHNSW_selectNeighborsHeuristic(t *testing.T) {
+	h := NewHNSW(HNSWOption{
+		M:                 3,
+		MaxLevel:          2,
+		VectorDim:         2,
+		NeighborHeuristic: true,
+
+		RNG: &StaticRNGMachine{Value: staticRNG},
+	})
+
+	base, _ := h.AddVector([]float32{0, 0})
+	near, _ := h.AddVector([]float32{1, 0})
+	behindNear, _ := h.AddVector([]float32{2, 0})
+	other, _ := h.AddVector([]float32{0, 1.5})
+
+	candidates := []pqItem{
+		{Value: near, Priority: 1},
+		{Value: other, Priority: 1.5},
+		{Value: behindNear, Priority: 2},
+	}
+
+	// behindNear is closer to near than to base, so it's pruned
+	got := h.selectNeighbors(base, candidates, h.M, 0, false)
+	expected := []int{near, other}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d neighbors, got %d", len(expected), len(got))
+	}
+	for idx := range expected {
+		if got[idx].Value != expected[idx] {
+			t.Errorf("expected %d neighbor id, got %d. idx %d", expected[idx], got[idx].Value, idx)
+		}
+	}
+
+	// pruned candidate is used to fill up until M
+	h.keepPrunedConnections = true
+	got = h.selectNeighbors(base, candidates, h.M, 0, false)
+	expected = []int{near, other, behindNear}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d neighbors, got %d", len(expected), len(got))
+	}
+	for idx := range expected {
+		if got[idx].Value != expected[idx] {
+			t.Errorf("expected %d neighbor id, got %d. idx %d", expected[idx], got[idx].Value, idx)
+		}
+	}
+}
+
+func TestHNSW_SearchWithFilter(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	filter := func(id int) bool {
+		return id%3 == 0
+	}
+
+	query := []float32{4.2, 4.7}
+	topK := 5
+
+	resultNodeID, resultDistance, err := h.SearchWithFilter(query, topK, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// brute force the expected distance
+	var expected []float32
+	for _, id := range ids {
+		if filter(id) {
+			expected = append(expected, h.distanceComputerFunc.CalcDistance(query, h.vector(id)))
+		}
+	}
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+
+	if len(resultNodeID) != topK {
+		t.Fatalf("expected %d result, got %d", topK, len(resultNodeID))
+	}
+	for idx, id := range resultNodeID {
+		if !filter(id) {
+			t.Errorf("node %d doesn't match the filter", id)
+		}
+		if resultDistance[idx] != expected[idx] {
+			t.Errorf("expected distance %f at index %d, got %f", expected[idx], idx, resultDistance[idx])
+		}
+	}
+
+	// filter matching nothing
+	resultNodeID, _, _ = h.SearchWithFilter(query, topK, func(id int) bool { return false })
+	if len(resultNodeID) != 0 {
+		t.Errorf("expected empty result, got %v", resultNodeID)
+	}
+}
+
+// run with -race to catch unsynchronized access
+func TestHNSW_ConcurrentSearchAndAdd(t *testing.T) {
+	h := NewHNSW(HNSWOption{
+		M:              8,
+		EfConstruction: 32,
+		EfSearch:       16,
+		VectorDim:      8,
+	})
+
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, 400, 8)
+
+	// seed the graph so search has something to find
+	for _, vector := range vectors[:50] {
+		h.AddVector(vector)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				result, _, err := h.Search(vectors[(w+i)%len(vectors)], 5)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(result) == 0 {
+					t.Error("expected non empty result")
+					return
+				}
+			}
+		}(w)
+	}
+
+	var writers sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for i := 50 + w; i < len(vectors); i += 2 {
+				if _, err := h.AddVector(vectors[i]); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for id := 0; id < 10; id++ {
+			h.Update(id+20, vectors[id])
+			h.Delete(id)
+		}
+	}()
+
+	writers.Wait()
+	close(done)
+	wg.Wait()
+
+	if h.nodes.len() != len(vectors) {
+		t.Errorf("expected %d nodes, got %d", len(vectors), h.nodes.len())
+	}
+}
+
+func TestHNSW_AddVectors(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vectors := randomVectors(rng, 1000, 16)
+	queries := vectors[:50]
+
+	newIndex := func() *HNSW {
+		return NewHNSW(HNSWOption{
+			M:                8,
+			EfConstruction:   64,
+			EfSearch:         32,
+			VectorDim:        16,
+			DistanceComputer: &L2SquaredDistance{},
+
+			RNG: rand.New(rand.NewSource(3)),
+		})
+	}
+
+	serial := newIndex()
+	serialIDs := make([]int, len(vectors))
+	for idx, vector := range vectors {
+		serialIDs[idx], _ = serial.AddVector(vector)
+	}
+
+	parallel := newIndex()
+	ids, err := parallel.AddVectors(vectors, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ids follow the input order
+	for idx, id := range ids {
+		if id != idx {
+			t.Errorf("expected id %d, got %d", idx, id)
+		}
+	}
+
+	serialRecall := recallAt(serial, vectors, serialIDs, queries, 10)
+	parallelRecall := recallAt(parallel, vectors, ids, queries, 10)
+	if parallelRecall < serialRecall-0.02 {
+		t.Errorf("parallel recall %f is lower than serial recall %f", parallelRecall, serialRecall)
+	}
+
+	if _, err := parallel.AddVectors([][]float32{{1, 2}}, 2); err == nil {
+		t.Errorf("expected error on different dimension")
+	}
+}
+
+// randomVectors return n vectors of dim uniform values in [0, 1)
+func randomVectors(rng *rand.Rand, n int, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()
+		}
+	}
+	return vectors
+}
+
+// recallAt compare the search result with brute force result, ids[i] is the node ID of vectors[i]
+func recallAt(h *HNSW, vectors [][]float32, ids []int, queries [][]float32, topK int) float64 {
+	// FlatIndex ID is the index in vectors
+	exact := NewFlatIndex(FlatOption{VectorDim: h.vectorDim, DistanceComputer: h.distanceComputerFunc})
+	for _, vector := range vectors {
+		exact.AddVector(vector)
+	}
+
+	var found int
+	for _, query := range queries {
+		exactResult, _, _ := exact.Search(query, topK)
+		expected := make(map[int]bool, topK)
+		for _, idx := range exactResult {
+			expected[ids[idx]] = true
+		}
+
+		result, _, _ := h.Search(query, topK)
+		for _, id := range result {
+			if expected[id] {
+				found++
+			}
+		}
+	}
+
+	return float64(found) / float64(len(queries)*topK)
+}
+
+func TestHNSW_M0(t *testing.T) {
+	h := NewHNSW(HNSWOption{
+		M:              2,
+		EfConstruction: 20,
+		MaxLevel:       3,
+		VectorDim:      2,
+
+		RNG: &StaticRNGMachine{Value: staticRNG},
+	})
+
+	if h.M0 != 4 {
+		t.Fatalf("expected default M0 4, got %d", h.M0)
+	}
+
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 10; y++ {
+			h.AddVector([]float32{float32(x), float32(y)})
+		}
+	}
+
+	var maxDegree0 int
+	for _, node := range h.nodes.toSlice() {
+		for level, neighbors := range node.PerLevelNeighbors {
+			if len(neighbors) > h.maxNeighbors(level) {
+				t.Errorf("node %d has %d neighbors on level %d", node.ID, len(neighbors), level)
+			}
+			if level == 0 && len(neighbors) > maxDegree0 {
+				maxDegree0 = len(neighbors)
+			}
+		}
+	}
+
+	if maxDegree0 <= h.M {
+		t.Errorf("expected level 0 to use more than M neighbors, got %d", maxDegree0)
+	}
+}
+
+func BenchmarkHNSW_Search(b *testing.B) {
+	const dim = 32
+
+	rng := rand.New(rand.NewSource(4))
+	vectors := randomVectors(rng, 5000, dim)
+	queries := randomVectors(rng, 100, dim)
+
+	h := NewHNSW(HNSWOption{
+		M:                16,
+		EfConstruction:   100,
+		EfSearch:         50,
+		VectorDim:        dim,
+		DistanceComputer: &L2SquaredDistance{},
+
+		RNG: rand.New(rand.NewSource(5)),
+	})
+	ids, _ := h.AddVectors(vectors, 0)
+
+	recall := recallAt(h, vectors, ids, queries, 10)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Search(queries[i%len(queries)], 10)
+	}
+	b.ReportMetric(recall, "recall@10")
+}
+
+func TestHNSW_NormalizeVector(t *testing.T) {
+	h := NewHNSW(HNSWOption{
+		M:                4,
+		EfConstruction:   20,
+		VectorDim:        2,
+		DistanceComputer: &InnerProductDistance{},
+		NormalizeVector:  true,
+
+		RNG: &StaticRNGMachine{Value: staticRNG},
+	})
+	if !h.normalizeVector {
+		t.Fatalf("expected NormalizeVector to be copied")
+	}
+
+	// different direction and length
+	for i := 1; i <= 10; i++ {
+		angle := float64(i) / 10
+		h.AddVector([]float32{float32(float64(i) * math.Cos(angle)), float32(float64(i) * math.Sin(angle))})
+	}
+	for id := 0; id < 10; id++ {
+		if norm := h.distanceComputerFunc.CalcDistance(h.vector(id), h.vector(id)); math.Abs(float64(norm+1)) > 1e-5 {
+			t.Errorf("expected unit vector %d, got squared norm %f", id, -norm)
+		}
+	}
+
+	// the query is normalized too, its length doesn't matter
+	short, shortDistance, _ := h.Search([]float32{0.1, 0.05}, 3)
+	long, longDistance, _ := h.Search([]float32{100, 50}, 3)
+	for idx := range short {
+		if short[idx] != long[idx] || math.Abs(float64(shortDistance[idx]-longDistance[idx])) > 1e-5 {
+			t.Errorf("expected same result, got %v %v and %v %v", short, shortDistance, long, longDistance)
+		}
+	}
+
+	// the distance and normalization survive save & load
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.normalizeVector || loaded.distanceComputerFunc.GetName() != InnerProductDistanceName {
+		t.Errorf("expected normalized %s, got %v %s", InnerProductDistanceName, loaded.normalizeVector, loaded.distanceComputerFunc.GetName())
+	}
+	loadedResult, _, _ := loaded.Search([]float32{100, 50}, 3)
+	for idx := range long {
+		if loadedResult[idx] != long[idx] {
+			t.Errorf("expected %v after loading, got %v", long, loadedResult)
+		}
+	}
+}
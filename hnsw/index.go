@@ -0,0 +1,80 @@
+package hnsw
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	IndexTypeHNSW = "hnsw"
+	IndexTypeFlat = "flat"
+)
+
+// Index is implemented by HNSW and FlatIndex, so the implementation can be chosen by configuration
+type Index interface {
+	// AddVector add the vector and return its ID
+	AddVector(vector []float32) (id int, err error)
+	// Search return the topK nearest IDs and their distance, closest first
+	Search(VecToSearch []float32, topK int) (resultNodeID []int, resultDistance []float32, err error)
+	// Delete remove the vector, the ID is not reused
+	Delete(id int) error
+	// Len return the number of vectors that are not deleted
+	Len() int
+	// SaveToDisk save the index, LoadIndex load it back
+	SaveToDisk(filepath string) error
+}
+
+var (
+	_ Index = (*HNSW)(nil)
+	_ Index = (*FlatIndex)(nil)
+)
+
+// IndexConfig choose the index created by NewIndex
+type IndexConfig struct {
+	Type string // IndexTypeHNSW or IndexTypeFlat, empty means IndexTypeHNSW
+
+	HNSW HNSWOption // used by IndexTypeHNSW
+	Flat FlatOption // used by IndexTypeFlat
+}
+
+// NewIndex create the index of config.Type
+func NewIndex(config IndexConfig) (Index, error) {
+	switch config.Type {
+	case IndexTypeHNSW, "":
+		h, err := newGenericHNSW(config.HNSW)
+		if err != nil {
+			return nil, fmt.Errorf("NewIndex : %w", err)
+		}
+		return h, nil
+	case IndexTypeFlat:
+		return NewFlatIndex(config.Flat), nil
+	default:
+		return nil, fmt.Errorf("NewIndex : unknown index type %q", config.Type)
+	}
+}
+
+// LoadIndex load an index saved by SaveToDisk whatever its type.
+// Index saved without type is HNSW
+func LoadIndex(filepath string) (Index, error) {
+	jsonOnDisk, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		IndexType string
+	}
+	err = json.Unmarshal(jsonOnDisk, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.IndexType {
+	case IndexTypeHNSW, "":
+		return hnswFromJSON[float32](jsonOnDisk)
+	case IndexTypeFlat:
+		return flatFromJSON(jsonOnDisk)
+	default:
+		return nil, fmt.Errorf("LoadIndex : unknown index type %q", header.IndexType)
+	}
+}
@@ -0,0 +1,76 @@
+package hnsw
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewIndex_InvalidOption(t *testing.T) {
+	for name, option := range map[string]HNSWOption{
+		"unknown quantization": {VectorDim: 4, Quantization: "unknown"},
+		"pq dimension":         {VectorDim: 10, Quantization: QuantizationPQ, PQSubquantizers: 3},
+	} {
+		index, err := NewIndex(IndexConfig{HNSW: option})
+		if err == nil || index != nil {
+			t.Errorf("%s: expected error, got %v", name, err)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	for _, indexType := range []string{IndexTypeHNSW, IndexTypeFlat} {
+		index, err := NewIndex(IndexConfig{
+			Type: indexType,
+			HNSW: HNSWOption{VectorDim: 2, RNG: &StaticRNGMachine{Value: staticRNG}},
+			Flat: FlatOption{VectorDim: 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 20; i++ {
+			index.AddVector([]float32{float32(i), float32(i)})
+		}
+		if err := index.Delete(5); err != nil {
+			t.Fatal(err)
+		}
+		if index.Len() != 19 {
+			t.Errorf("%s: expected len 19, got %d", indexType, index.Len())
+		}
+
+		path := filepath.Join(t.TempDir(), "index.db")
+		if err := index.SaveToDisk(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Len() != 19 {
+			t.Errorf("%s: expected loaded len 19, got %d", indexType, loaded.Len())
+		}
+
+		switch loaded.(type) {
+		case *HNSW:
+			if indexType != IndexTypeHNSW {
+				t.Errorf("expected %s, loaded HNSW", indexType)
+			}
+		case *FlatIndex:
+			if indexType != IndexTypeFlat {
+				t.Errorf("expected %s, loaded FlatIndex", indexType)
+			}
+		}
+
+		resultNodeID, _, err := loaded.Search([]float32{5, 5}, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resultNodeID) != 3 || resultNodeID[0] == 5 {
+			t.Errorf("%s: expected 3 results without 5, got %v", indexType, resultNodeID)
+		}
+	}
+
+	if _, err := NewIndex(IndexConfig{Type: "ivf"}); err == nil {
+		t.Errorf("expected error on unknown index type")
+	}
+}
@@ -0,0 +1,38 @@
+package hnsw
+
+// The distance kernels are the hottest path of both build and search.
+// They point to the pure Go version and are replaced at init by the
+// assembly version when the CPU supports it, see kernel_amd64.go and kernel_arm64.go.
+// vec2 must be at least as long as vec1
+var (
+	l2SquaredKernel = l2SquaredGeneric
+	dotKernel       = dotGeneric
+	cosineKernel    = cosineGeneric // dot product and both squared norms in one pass
+)
+
+func l2SquaredGeneric(vec1, vec2 []float32) (sumOfSquares float32) {
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		diff := vec1[i] - vec2[i]
+		sumOfSquares += diff * diff
+	}
+	return sumOfSquares
+}
+
+func dotGeneric(vec1, vec2 []float32) (dot float32) {
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		dot += vec1[i] * vec2[i]
+	}
+	return dot
+}
+
+func cosineGeneric(vec1, vec2 []float32) (dot, norm1, norm2 float32) {
+	vec2 = vec2[:len(vec1)]
+	for i := range vec1 {
+		dot += vec1[i] * vec2[i]
+		norm1 += vec1[i] * vec1[i]
+		norm2 += vec2[i] * vec2[i]
+	}
+	return dot, norm1, norm2
+}
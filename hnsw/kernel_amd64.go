@@ -0,0 +1,48 @@
+//go:build !purego
+
+package hnsw
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasAVX2 && cpu.X86.HasFMA {
+		l2SquaredKernel = l2SquaredAVX2
+		dotKernel = dotAVX2
+		cosineKernel = cosineAVX2
+	}
+}
+
+// implemented in kernel_amd64.s, n is the number of dimensions
+
+//go:noescape
+func l2SquaredAVX2Asm(vec1, vec2 *float32, n int) float32
+
+//go:noescape
+func dotAVX2Asm(vec1, vec2 *float32, n int) float32
+
+//go:noescape
+func cosineAVX2Asm(vec1, vec2 *float32, n int) (dot, norm1, norm2 float32)
+
+func l2SquaredAVX2(vec1, vec2 []float32) float32 {
+	if len(vec1) == 0 {
+		return 0
+	}
+	vec2 = vec2[:len(vec1)]
+	return l2SquaredAVX2Asm(&vec1[0], &vec2[0], len(vec1))
+}
+
+func dotAVX2(vec1, vec2 []float32) float32 {
+	if len(vec1) == 0 {
+		return 0
+	}
+	vec2 = vec2[:len(vec1)]
+	return dotAVX2Asm(&vec1[0], &vec2[0], len(vec1))
+}
+
+func cosineAVX2(vec1, vec2 []float32) (dot, norm1, norm2 float32) {
+	if len(vec1) == 0 {
+		return 0, 0, 0
+	}
+	vec2 = vec2[:len(vec1)]
+	return cosineAVX2Asm(&vec1[0], &vec2[0], len(vec1))
+}
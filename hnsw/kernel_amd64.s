@@ -0,0 +1,206 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// REDUCE sums the 8 lanes of Y into the lowest lane of X
+#define REDUCE(Y, X, TMP) \
+	VEXTRACTF128 $1, Y, TMP \
+	VADDPS       TMP, X, X  \
+	VHADDPS      X, X, X    \
+	VHADDPS      X, X, X
+
+// func l2SquaredAVX2Asm(vec1, vec2 *float32, n int) float32
+TEXT ·l2SquaredAVX2Asm(SB), NOSPLIT, $0-28
+	MOVQ vec1+0(FP), SI
+	MOVQ vec2+8(FP), DI
+	MOVQ n+16(FP), CX
+
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+
+	// 32 dimensions per iteration, 4 accumulators hide the FMA latency
+l2loop32:
+	CMPQ        CX, $32
+	JL          l2loop8
+	VMOVUPS     (SI), Y4
+	VMOVUPS     32(SI), Y5
+	VMOVUPS     64(SI), Y6
+	VMOVUPS     96(SI), Y7
+	VSUBPS      (DI), Y4, Y4
+	VSUBPS      32(DI), Y5, Y5
+	VSUBPS      64(DI), Y6, Y6
+	VSUBPS      96(DI), Y7, Y7
+	VFMADD231PS Y4, Y4, Y0
+	VFMADD231PS Y5, Y5, Y1
+	VFMADD231PS Y6, Y6, Y2
+	VFMADD231PS Y7, Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         l2loop32
+
+l2loop8:
+	CMPQ        CX, $8
+	JL          l2reduce
+	VMOVUPS     (SI), Y4
+	VSUBPS      (DI), Y4, Y4
+	VFMADD231PS Y4, Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         l2loop8
+
+l2reduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+	REDUCE(Y0, X0, X1)
+
+l2tail:
+	CMPQ        CX, $0
+	JE          l2done
+	VMOVSS      (SI), X1
+	VSUBSS      (DI), X1, X1
+	VFMADD231SS X1, X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         l2tail
+
+l2done:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
+
+// func dotAVX2Asm(vec1, vec2 *float32, n int) float32
+TEXT ·dotAVX2Asm(SB), NOSPLIT, $0-28
+	MOVQ vec1+0(FP), SI
+	MOVQ vec2+8(FP), DI
+	MOVQ n+16(FP), CX
+
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+
+dotloop32:
+	CMPQ        CX, $32
+	JL          dotloop8
+	VMOVUPS     (SI), Y4
+	VMOVUPS     32(SI), Y5
+	VMOVUPS     64(SI), Y6
+	VMOVUPS     96(SI), Y7
+	VFMADD231PS (DI), Y4, Y0
+	VFMADD231PS 32(DI), Y5, Y1
+	VFMADD231PS 64(DI), Y6, Y2
+	VFMADD231PS 96(DI), Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         dotloop32
+
+dotloop8:
+	CMPQ        CX, $8
+	JL          dotreduce
+	VMOVUPS     (SI), Y4
+	VFMADD231PS (DI), Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         dotloop8
+
+dotreduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+	REDUCE(Y0, X0, X1)
+
+dottail:
+	CMPQ        CX, $0
+	JE          dotdone
+	VMOVSS      (SI), X1
+	VFMADD231SS (DI), X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         dottail
+
+dotdone:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
+
+// func cosineAVX2Asm(vec1, vec2 *float32, n int) (dot, norm1, norm2 float32)
+TEXT ·cosineAVX2Asm(SB), NOSPLIT, $0-36
+	MOVQ vec1+0(FP), SI
+	MOVQ vec2+8(FP), DI
+	MOVQ n+16(FP), CX
+
+	// Y0, Y1 dot, Y2, Y3 norm1, Y4, Y5 norm2
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+	VXORPS Y4, Y4, Y4
+	VXORPS Y5, Y5, Y5
+
+cosloop16:
+	CMPQ        CX, $16
+	JL          cosloop8
+	VMOVUPS     (SI), Y6
+	VMOVUPS     32(SI), Y7
+	VMOVUPS     (DI), Y8
+	VMOVUPS     32(DI), Y9
+	VFMADD231PS Y8, Y6, Y0
+	VFMADD231PS Y9, Y7, Y1
+	VFMADD231PS Y6, Y6, Y2
+	VFMADD231PS Y7, Y7, Y3
+	VFMADD231PS Y8, Y8, Y4
+	VFMADD231PS Y9, Y9, Y5
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         cosloop16
+
+cosloop8:
+	CMPQ        CX, $8
+	JL          cosreduce
+	VMOVUPS     (SI), Y6
+	VMOVUPS     (DI), Y8
+	VFMADD231PS Y8, Y6, Y0
+	VFMADD231PS Y6, Y6, Y2
+	VFMADD231PS Y8, Y8, Y4
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         cosloop8
+
+cosreduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y5, Y4, Y4
+	REDUCE(Y0, X0, X1)
+	REDUCE(Y2, X2, X3)
+	REDUCE(Y4, X4, X5)
+
+costail:
+	CMPQ        CX, $0
+	JE          cosdone
+	VMOVSS      (SI), X6
+	VMOVSS      (DI), X8
+	VFMADD231SS X8, X6, X0
+	VFMADD231SS X6, X6, X2
+	VFMADD231SS X8, X8, X4
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         costail
+
+cosdone:
+	VZEROUPPER
+	MOVSS X0, dot+24(FP)
+	MOVSS X2, norm1+28(FP)
+	MOVSS X4, norm2+32(FP)
+	RET
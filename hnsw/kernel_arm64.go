@@ -0,0 +1,78 @@
+//go:build !purego
+
+package hnsw
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.ARM64.HasASIMD {
+		l2SquaredKernel = l2SquaredNEON
+		dotKernel = dotNEON
+		cosineKernel = cosineNEON
+	}
+}
+
+// implemented in kernel_arm64.s, n must be a multiple of 16 for l2Squared and dot, 8 for cosine.
+// The lanes of the accumulators are summed in Go together with the remaining dimensions
+
+//go:noescape
+func l2SquaredNEONAsm(vec1, vec2 *float32, n int, acc *[4]float32)
+
+//go:noescape
+func dotNEONAsm(vec1, vec2 *float32, n int, acc *[4]float32)
+
+//go:noescape
+func cosineNEONAsm(vec1, vec2 *float32, n int, acc *[12]float32)
+
+func l2SquaredNEON(vec1, vec2 []float32) (sumOfSquares float32) {
+	vec2 = vec2[:len(vec1)]
+
+	n := len(vec1) &^ 15
+	if n > 0 {
+		var acc [4]float32
+		l2SquaredNEONAsm(&vec1[0], &vec2[0], n, &acc)
+		sumOfSquares = acc[0] + acc[1] + acc[2] + acc[3]
+	}
+
+	for i := n; i < len(vec1); i++ {
+		diff := vec1[i] - vec2[i]
+		sumOfSquares += diff * diff
+	}
+	return sumOfSquares
+}
+
+func dotNEON(vec1, vec2 []float32) (dot float32) {
+	vec2 = vec2[:len(vec1)]
+
+	n := len(vec1) &^ 15
+	if n > 0 {
+		var acc [4]float32
+		dotNEONAsm(&vec1[0], &vec2[0], n, &acc)
+		dot = acc[0] + acc[1] + acc[2] + acc[3]
+	}
+
+	for i := n; i < len(vec1); i++ {
+		dot += vec1[i] * vec2[i]
+	}
+	return dot
+}
+
+func cosineNEON(vec1, vec2 []float32) (dot, norm1, norm2 float32) {
+	vec2 = vec2[:len(vec1)]
+
+	n := len(vec1) &^ 7
+	if n > 0 {
+		var acc [12]float32
+		cosineNEONAsm(&vec1[0], &vec2[0], n, &acc)
+		dot = acc[0] + acc[1] + acc[2] + acc[3]
+		norm1 = acc[4] + acc[5] + acc[6] + acc[7]
+		norm2 = acc[8] + acc[9] + acc[10] + acc[11]
+	}
+
+	for i := n; i < len(vec1); i++ {
+		dot += vec1[i] * vec2[i]
+		norm1 += vec1[i] * vec1[i]
+		norm2 += vec2[i] * vec2[i]
+	}
+	return dot, norm1, norm2
+}
@@ -0,0 +1,104 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func l2SquaredNEONAsm(vec1, vec2 *float32, n int, acc *[4]float32)
+TEXT ·l2SquaredNEONAsm(SB), NOSPLIT, $0-32
+	MOVD vec1+0(FP), R0
+	MOVD vec2+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVD acc+24(FP), R3
+
+	VEOR V16.B16, V16.B16, V16.B16
+	VEOR V17.B16, V17.B16, V17.B16
+	VEOR V18.B16, V18.B16, V18.B16
+	VEOR V19.B16, V19.B16, V19.B16
+
+	// 16 dimensions per iteration, 4 accumulators hide the FMA latency
+l2loop:
+	CBZ    R2, l2done
+	VLD1.P 64(R0), [V0.S4, V1.S4, V2.S4, V3.S4]
+	VLD1.P 64(R1), [V4.S4, V5.S4, V6.S4, V7.S4]
+	VFSUB  V4.S4, V0.S4, V0.S4
+	VFSUB  V5.S4, V1.S4, V1.S4
+	VFSUB  V6.S4, V2.S4, V2.S4
+	VFSUB  V7.S4, V3.S4, V3.S4
+	VFMLA  V0.S4, V0.S4, V16.S4
+	VFMLA  V1.S4, V1.S4, V17.S4
+	VFMLA  V2.S4, V2.S4, V18.S4
+	VFMLA  V3.S4, V3.S4, V19.S4
+	SUB    $16, R2, R2
+	B      l2loop
+
+l2done:
+	VFADD V17.S4, V16.S4, V16.S4
+	VFADD V19.S4, V18.S4, V18.S4
+	VFADD V18.S4, V16.S4, V16.S4
+	VST1  [V16.S4], (R3)
+	RET
+
+// func dotNEONAsm(vec1, vec2 *float32, n int, acc *[4]float32)
+TEXT ·dotNEONAsm(SB), NOSPLIT, $0-32
+	MOVD vec1+0(FP), R0
+	MOVD vec2+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVD acc+24(FP), R3
+
+	VEOR V16.B16, V16.B16, V16.B16
+	VEOR V17.B16, V17.B16, V17.B16
+	VEOR V18.B16, V18.B16, V18.B16
+	VEOR V19.B16, V19.B16, V19.B16
+
+dotloop:
+	CBZ    R2, dotdone
+	VLD1.P 64(R0), [V0.S4, V1.S4, V2.S4, V3.S4]
+	VLD1.P 64(R1), [V4.S4, V5.S4, V6.S4, V7.S4]
+	VFMLA  V4.S4, V0.S4, V16.S4
+	VFMLA  V5.S4, V1.S4, V17.S4
+	VFMLA  V6.S4, V2.S4, V18.S4
+	VFMLA  V7.S4, V3.S4, V19.S4
+	SUB    $16, R2, R2
+	B      dotloop
+
+dotdone:
+	VFADD V17.S4, V16.S4, V16.S4
+	VFADD V19.S4, V18.S4, V18.S4
+	VFADD V18.S4, V16.S4, V16.S4
+	VST1  [V16.S4], (R3)
+	RET
+
+// func cosineNEONAsm(vec1, vec2 *float32, n int, acc *[12]float32)
+TEXT ·cosineNEONAsm(SB), NOSPLIT, $0-32
+	MOVD vec1+0(FP), R0
+	MOVD vec2+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVD acc+24(FP), R3
+
+	// V16, V19 dot, V17, V20 norm1, V18, V21 norm2
+	VEOR V16.B16, V16.B16, V16.B16
+	VEOR V17.B16, V17.B16, V17.B16
+	VEOR V18.B16, V18.B16, V18.B16
+	VEOR V19.B16, V19.B16, V19.B16
+	VEOR V20.B16, V20.B16, V20.B16
+	VEOR V21.B16, V21.B16, V21.B16
+
+	// 8 dimensions per iteration
+cosloop:
+	CBZ    R2, cosdone
+	VLD1.P 32(R0), [V0.S4, V1.S4]
+	VLD1.P 32(R1), [V2.S4, V3.S4]
+	VFMLA  V2.S4, V0.S4, V16.S4
+	VFMLA  V3.S4, V1.S4, V19.S4
+	VFMLA  V0.S4, V0.S4, V17.S4
+	VFMLA  V1.S4, V1.S4, V20.S4
+	VFMLA  V2.S4, V2.S4, V18.S4
+	VFMLA  V3.S4, V3.S4, V21.S4
+	SUB    $8, R2, R2
+	B      cosloop
+
+cosdone:
+	VFADD V19.S4, V16.S4, V16.S4
+	VFADD V20.S4, V17.S4, V17.S4
+	VFADD V21.S4, V18.S4, V18.S4
+	VST1  [V16.S4, V17.S4, V18.S4], (R3)
+	RET
@@ -0,0 +1,163 @@
+package hnsw
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var benchmarkDims = []int{128, 384, 768, 1536}
+
+// kernelCase compare the selected kernel with the pure Go one.
+// tolerance is computed from the generic kernel on absolute values,
+// the summation order differs so the error grows with the magnitude of the terms
+type kernelCase struct {
+	name      string
+	selected  func(vec1, vec2 []float32) float32
+	generic   func(vec1, vec2 []float32) float32
+	magnitude func(vec1, vec2 []float32) float32
+}
+
+func absVector(vec []float32) []float32 {
+	result := make([]float32, len(vec))
+	for i := range vec {
+		result[i] = abs(vec[i])
+	}
+	return result
+}
+
+func kernelCases() []kernelCase {
+	pick := func(kernel func(vec1, vec2 []float32) (float32, float32, float32), idx int) func(vec1, vec2 []float32) float32 {
+		return func(vec1, vec2 []float32) float32 {
+			result := [3]float32{}
+			result[0], result[1], result[2] = kernel(vec1, vec2)
+			return result[idx]
+		}
+	}
+	dotMagnitude := func(vec1, vec2 []float32) float32 {
+		return dotGeneric(absVector(vec1), absVector(vec2))
+	}
+
+	return []kernelCase{
+		{"l2Squared", l2SquaredKernel, l2SquaredGeneric, l2SquaredGeneric},
+		{"dot", dotKernel, dotGeneric, dotMagnitude},
+		{"cosine.dot", pick(cosineKernel, 0), pick(cosineGeneric, 0), dotMagnitude},
+		{"cosine.norm1", pick(cosineKernel, 1), pick(cosineGeneric, 1), pick(cosineGeneric, 1)},
+		{"cosine.norm2", pick(cosineKernel, 2), pick(cosineGeneric, 2), pick(cosineGeneric, 2)},
+	}
+}
+
+func checkKernels(t *testing.T, vec1, vec2 []float32) {
+	t.Helper()
+	for _, c := range kernelCases() {
+		got := c.selected(vec1, vec2)
+		expected := c.generic(vec1, vec2)
+		tolerance := 1e-5*float64(c.magnitude(vec1, vec2)) + 1e-6
+		if math.Abs(float64(got-expected)) > tolerance {
+			t.Fatalf("%s of %d dims: expected %v, got %v", c.name, len(vec1), expected, got)
+		}
+	}
+}
+
+func randomPair(rng *rand.Rand, dim int) ([]float32, []float32) {
+	vec1 := make([]float32, dim)
+	vec2 := make([]float32, dim)
+	for i := range vec1 {
+		vec1[i] = rng.Float32()*2 - 1
+		vec2[i] = rng.Float32()*2 - 1
+	}
+	return vec1, vec2
+}
+
+func TestKernels(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+
+	// every remainder of the unrolled loops
+	for dim := 0; dim <= 70; dim++ {
+		vec1, vec2 := randomPair(rng, dim)
+		checkKernels(t, vec1, vec2)
+	}
+	for _, dim := range benchmarkDims {
+		vec1, vec2 := randomPair(rng, dim)
+		checkKernels(t, vec1, vec2)
+	}
+
+	// vec2 longer than vec1 only uses the first dimensions
+	vec1, vec2 := randomPair(rng, 40)
+	if l2SquaredKernel(vec1[:33], vec2) != l2SquaredKernel(vec1[:33], vec2[:33]) {
+		t.Errorf("expected only the first 33 dimensions to be used")
+	}
+}
+
+// bytesToVectors split the fuzz input into two vectors, NaN and Inf are replaced
+func bytesToVectors(data []byte) ([]float32, []float32) {
+	dim := len(data) / 8
+	vec1 := make([]float32, dim)
+	vec2 := make([]float32, dim)
+	for i := 0; i < dim; i++ {
+		vec1[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		vec2[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[(dim+i)*4:]))
+	}
+	for _, vec := range [][]float32{vec1, vec2} {
+		for i := range vec {
+			// keep the squares far from overflowing
+			if math.IsNaN(float64(vec[i])) || math.IsInf(float64(vec[i]), 0) || abs(vec[i]) > 1e6 {
+				vec[i] = float32(i % 7)
+			}
+		}
+	}
+	return vec1, vec2
+}
+
+func FuzzKernels(f *testing.F) {
+	rng := rand.New(rand.NewSource(17))
+	for _, dim := range []int{1, 7, 8, 15, 16, 17, 31, 32, 33, 100} {
+		data := make([]byte, dim*8)
+		rng.Read(data)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		vec1, vec2 := bytesToVectors(data)
+		checkKernels(t, vec1, vec2)
+	})
+}
+
+func BenchmarkKernels(b *testing.B) {
+	rng := rand.New(rand.NewSource(19))
+
+	kernels := []struct {
+		name     string
+		selected func(vec1, vec2 []float32) float32
+		generic  func(vec1, vec2 []float32) float32
+	}{
+		{"l2Squared", l2SquaredKernel, l2SquaredGeneric},
+		{"dot", dotKernel, dotGeneric},
+		{"cosine", func(vec1, vec2 []float32) float32 {
+			dot, _, _ := cosineKernel(vec1, vec2)
+			return dot
+		}, func(vec1, vec2 []float32) float32 {
+			dot, _, _ := cosineGeneric(vec1, vec2)
+			return dot
+		}},
+	}
+
+	for _, kernel := range kernels {
+		for _, dim := range benchmarkDims {
+			vec1, vec2 := randomPair(rng, dim)
+			for _, impl := range []struct {
+				name string
+				fn   func(vec1, vec2 []float32) float32
+			}{{"generic", kernel.generic}, {"selected", kernel.selected}} {
+				b.Run(fmt.Sprintf("%s/%s/%d", kernel.name, impl.name, dim), func(b *testing.B) {
+					b.SetBytes(int64(dim * 4 * 2))
+					for i := 0; i < b.N; i++ {
+						impl.fn(vec1, vec2)
+					}
+				})
+			}
+		}
+	}
+}
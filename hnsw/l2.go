@@ -4,12 +4,7 @@ import (
 	"math"
 )
 
-type distanceComputer interface {
-	CalcDistance(vec1, vec2 []float32) float32
-	GetName() string
-}
-
-const l2DistanceName = "L2Distance"
+const L2DistanceName = "L2Distance"
 const L2SquaredDistanceName = "L2SquaredDistance"
 
 type (
@@ -20,26 +15,43 @@ type (
 // L2Distance calculates the Euclidean (L2) distance between two vectors.
 // It returns an error if the vectors have different lengths.
 func (L2 *L2Distance) CalcDistance(vec1, vec2 []float32) float32 {
-	var sumOfSquares float32
-	for i := 0; i < len(vec1); i++ {
-		diff := vec1[i] - vec2[i]
-		sumOfSquares += diff * diff
-	}
+	return float32(math.Sqrt(float64(l2SquaredKernel(vec1, vec2))))
+}
 
-	return float32(math.Sqrt(float64(sumOfSquares)))
+// CalcDistanceBounded is CalcDistance that may stop once the distance exceeds bound
+func (L2 *L2Distance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) float32 {
+	if bound < 0 {
+		return L2.CalcDistance(vec1, vec2)
+	}
+	return float32(math.Sqrt(float64(l2SquaredBounded(vec1, vec2, bound*bound))))
 }
 
 func (L2 *L2Distance) GetName() string {
-	return l2DistanceName
+	return L2DistanceName
 }
 
 func (L2 *L2SquaredDistance) CalcDistance(vec1, vec2 []float32) (sumOfSquares float32) {
-	var diff float32
-	for i := range vec1 {
-		diff = vec1[i] - vec2[i]
-		sumOfSquares += diff * diff
+	return l2SquaredKernel(vec1, vec2)
+}
+
+// CalcDistanceBounded is CalcDistance that may stop once the distance exceeds bound
+func (L2 *L2SquaredDistance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) float32 {
+	return l2SquaredBounded(vec1, vec2, bound)
+}
+
+// l2SquaredBounded sums boundedChunk dimensions at a time using the kernel.
+// The chunks are rounded differently than the whole vector, so when the sum of every chunk
+// is within bound the whole vector is summed again to return exactly CalcDistance.
+// Only the nodes nearer than bound pay for it, the others stop early
+func l2SquaredBounded(vec1, vec2 []float32, bound float32) (sumOfSquares float32) {
+	vec2 = vec2[:len(vec1)]
+	for start := 0; start+boundedChunk < len(vec1); start += boundedChunk {
+		sumOfSquares += l2SquaredKernel(vec1[start:start+boundedChunk], vec2[start:start+boundedChunk])
+		if sumOfSquares > bound {
+			return sumOfSquares
+		}
 	}
-	return sumOfSquares
+	return l2SquaredKernel(vec1, vec2)
 }
 
 func (L2 *L2SquaredDistance) GetName() string {
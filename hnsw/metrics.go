@@ -0,0 +1,170 @@
+package hnsw
+
+const ManhattanDistanceName = "ManhattanDistance"
+const ChebyshevDistanceName = "ChebyshevDistance"
+const HammingDistanceName = "HammingDistance"
+const JaccardDistanceName = "JaccardDistance"
+const CanberraDistanceName = "CanberraDistance"
+
+type (
+	ManhattanDistance struct{}
+	ChebyshevDistance struct{}
+	HammingDistance   struct{}
+	JaccardDistance   struct{}
+	CanberraDistance  struct{}
+)
+
+func abs(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// ManhattanDistance calculates the L1 distance, the sum of absolute differences
+func (m *ManhattanDistance) CalcDistance(vec1, vec2 []float32) (sum float32) {
+	for i := range vec1 {
+		sum += abs(vec1[i] - vec2[i])
+	}
+	return sum
+}
+
+// CalcDistanceBounded is CalcDistance that may stop once the distance exceeds bound
+func (m *ManhattanDistance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) (sum float32) {
+	vec2 = vec2[:len(vec1)]
+	for start := 0; start < len(vec1); start += boundedChunk {
+		end := min(start+boundedChunk, len(vec1))
+		for i := start; i < end; i++ {
+			sum += abs(vec1[i] - vec2[i])
+		}
+		if sum > bound {
+			break
+		}
+	}
+	return sum
+}
+
+func (m *ManhattanDistance) GetName() string {
+	return ManhattanDistanceName
+}
+
+// ChebyshevDistance calculates the L-infinity distance, the largest absolute difference
+func (c *ChebyshevDistance) CalcDistance(vec1, vec2 []float32) (largest float32) {
+	for i := range vec1 {
+		if diff := abs(vec1[i] - vec2[i]); diff > largest {
+			largest = diff
+		}
+	}
+	return largest
+}
+
+// CalcDistanceBounded is CalcDistance that stops at the first difference exceeding bound
+func (c *ChebyshevDistance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) (largest float32) {
+	for i := range vec1 {
+		if diff := abs(vec1[i] - vec2[i]); diff > largest {
+			largest = diff
+			if largest > bound {
+				break
+			}
+		}
+	}
+	return largest
+}
+
+func (c *ChebyshevDistance) GetName() string {
+	return ChebyshevDistanceName
+}
+
+// HammingDistance binarize the vectors, value > 0 is 1 otherwise 0,
+// and count the dimensions having different bits.
+// Binary fingerprint can be stored as 0 and 1
+func (h *HammingDistance) CalcDistance(vec1, vec2 []float32) (count float32) {
+	for i := range vec1 {
+		if (vec1[i] > 0) != (vec2[i] > 0) {
+			count++
+		}
+	}
+	return count
+}
+
+// CalcDistanceBounded is CalcDistance that may stop once the distance exceeds bound
+func (h *HammingDistance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) (count float32) {
+	vec2 = vec2[:len(vec1)]
+	for start := 0; start < len(vec1); start += boundedChunk {
+		end := min(start+boundedChunk, len(vec1))
+		for i := start; i < end; i++ {
+			if (vec1[i] > 0) != (vec2[i] > 0) {
+				count++
+			}
+		}
+		if count > bound {
+			break
+		}
+	}
+	return count
+}
+
+func (h *HammingDistance) GetName() string {
+	return HammingDistanceName
+}
+
+// JaccardDistance calculates the weighted Jaccard distance 1 - sum(min) / sum(max) of non negative vectors,
+// like counts or weights. It's 0 when both vectors are zero
+func (j *JaccardDistance) CalcDistance(vec1, vec2 []float32) float32 {
+	var sumMin, sumMax float32
+	for i := range vec1 {
+		if vec1[i] < vec2[i] {
+			sumMin += vec1[i]
+			sumMax += vec2[i]
+		} else {
+			sumMin += vec2[i]
+			sumMax += vec1[i]
+		}
+	}
+
+	if sumMax == 0 {
+		return 0
+	}
+
+	return 1 - sumMin/sumMax
+}
+
+func (j *JaccardDistance) GetName() string {
+	return JaccardDistanceName
+}
+
+// CanberraDistance calculates sum(|a - b| / (|a| + |b|)), dimension where both are 0 counts as 0.
+// It's sensitive to small changes near zero, which suits sparse counts
+func (c *CanberraDistance) CalcDistance(vec1, vec2 []float32) (sum float32) {
+	for i := range vec1 {
+		denominator := abs(vec1[i]) + abs(vec2[i])
+		if denominator == 0 {
+			continue
+		}
+		sum += abs(vec1[i]-vec2[i]) / denominator
+	}
+	return sum
+}
+
+// CalcDistanceBounded is CalcDistance that may stop once the distance exceeds bound
+func (c *CanberraDistance) CalcDistanceBounded(vec1, vec2 []float32, bound float32) (sum float32) {
+	vec2 = vec2[:len(vec1)]
+	for start := 0; start < len(vec1); start += boundedChunk {
+		end := min(start+boundedChunk, len(vec1))
+		for i := start; i < end; i++ {
+			denominator := abs(vec1[i]) + abs(vec2[i])
+			if denominator == 0 {
+				continue
+			}
+			sum += abs(vec1[i]-vec2[i]) / denominator
+		}
+		if sum > bound {
+			break
+		}
+	}
+	return sum
+}
+
+func (c *CanberraDistance) GetName() string {
+	return CanberraDistanceName
+}
@@ -0,0 +1,129 @@
+package hnsw
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	// naive float64 references following the textbook definitions
+	references := []struct {
+		distance    DistanceComputer
+		nonNegative bool
+		reference   func(a, b []float64) float64
+	}{
+		{&ManhattanDistance{}, false, func(a, b []float64) (sum float64) {
+			for i := range a {
+				sum += math.Abs(a[i] - b[i])
+			}
+			return
+		}},
+		{&ChebyshevDistance{}, false, func(a, b []float64) (largest float64) {
+			for i := range a {
+				largest = math.Max(largest, math.Abs(a[i]-b[i]))
+			}
+			return
+		}},
+		{&HammingDistance{}, false, func(a, b []float64) (count float64) {
+			for i := range a {
+				bitA, bitB := 0, 0
+				if a[i] > 0 {
+					bitA = 1
+				}
+				if b[i] > 0 {
+					bitB = 1
+				}
+				count += float64(bitA ^ bitB)
+			}
+			return
+		}},
+		{&JaccardDistance{}, true, func(a, b []float64) float64 {
+			var sumMin, sumMax float64
+			for i := range a {
+				sumMin += math.Min(a[i], b[i])
+				sumMax += math.Max(a[i], b[i])
+			}
+			if sumMax == 0 {
+				return 0
+			}
+			return 1 - sumMin/sumMax
+		}},
+		{&CanberraDistance{}, false, func(a, b []float64) (sum float64) {
+			for i := range a {
+				if a[i] == 0 && b[i] == 0 {
+					continue
+				}
+				sum += math.Abs(a[i]-b[i]) / (math.Abs(a[i]) + math.Abs(b[i]))
+			}
+			return
+		}},
+	}
+
+	rng := rand.New(rand.NewSource(11))
+	randomVector := func(nonNegative bool) ([]float32, []float64) {
+		vec32 := make([]float32, 16)
+		vec64 := make([]float64, 16)
+		for i := range vec32 {
+			// sparse, so zeros are covered
+			if rng.Intn(3) == 0 {
+				continue
+			}
+			value := rng.Float64()*10 - 5
+			if nonNegative {
+				value = math.Abs(value)
+			}
+			vec32[i] = float32(value)
+			vec64[i] = float64(vec32[i])
+		}
+		return vec32, vec64
+	}
+
+	for _, r := range references {
+		for n := 0; n < 100; n++ {
+			a32, a64 := randomVector(r.nonNegative)
+			b32, b64 := randomVector(r.nonNegative)
+
+			got := r.distance.CalcDistance(a32, b32)
+			expected := r.reference(a64, b64)
+			if math.Abs(float64(got)-expected) > 1e-4*math.Max(1, expected) {
+				t.Fatalf("%s: expected %f, got %f for %v %v", r.distance.GetName(), expected, got, a32, b32)
+			}
+
+			if self := r.distance.CalcDistance(a32, a32); self != 0 {
+				t.Fatalf("%s: expected 0 to itself, got %f", r.distance.GetName(), self)
+			}
+		}
+
+		// zero vectors
+		zero := make([]float32, 16)
+		if got := r.distance.CalcDistance(zero, zero); got != 0 {
+			t.Errorf("%s: expected 0 between zero vectors, got %f", r.distance.GetName(), got)
+		}
+	}
+}
+
+func TestMetrics_LoadFromDisk(t *testing.T) {
+	distances := []DistanceComputer{
+		&L2Distance{}, &L2SquaredDistance{}, &CosineDistance{}, &InnerProductDistance{},
+		&ManhattanDistance{}, &ChebyshevDistance{}, &HammingDistance{}, &JaccardDistance{}, &CanberraDistance{},
+	}
+
+	for _, distance := range distances {
+		h := NewHNSW(HNSWOption{VectorDim: 2, DistanceComputer: distance})
+		h.AddVector([]float32{1, 2})
+
+		path := filepath.Join(t.TempDir(), "index.db")
+		if err := h.SaveToDisk(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadFromDisk(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.distanceComputerFunc.GetName() != distance.GetName() {
+			t.Errorf("expected %s after loading, got %s", distance.GetName(), loaded.distanceComputerFunc.GetName())
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package hnsw
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const defaultPQBits = 8
+
+// pqIterations is the maximum number of k-means iterations, it usually converges before
+const pqIterations = 25
+
+// pqQuantizer is the product quantizer of QuantizationPQ.
+// The vector is split into Subquantizers sub vectors, every sub vector is replaced
+// by the index of its nearest centroid, learned by k-means on the samples.
+// The indexes are packed using Bits bits each
+type pqQuantizer struct {
+	Subquantizers int
+	Bits          int
+	// Centroids[m] holds the 1<<Bits centroids of sub vector m one after another
+	Centroids [][]float32
+
+	vectorDim int
+	distance  DistanceComputer
+}
+
+func newPQQuantizer(vectorDim int, subquantizers int, bits int, distance DistanceComputer) *pqQuantizer {
+	if subquantizers == 0 {
+		subquantizers = vectorDim / 4
+	}
+	if bits == 0 {
+		bits = defaultPQBits
+	}
+
+	return &pqQuantizer{Subquantizers: subquantizers, Bits: bits, vectorDim: vectorDim, distance: distance}
+}
+
+// centroids is the number of centroids of every sub vector
+func (q *pqQuantizer) centroids() int {
+	return 1 << q.Bits
+}
+
+func (q *pqQuantizer) subDim() int {
+	return q.vectorDim / q.Subquantizers
+}
+
+// codeSize is the number of bytes of a code
+func (q *pqQuantizer) codeSize() int {
+	return (q.Subquantizers*q.Bits + 7) / 8
+}
+
+func (q *pqQuantizer) validate() error {
+	if q.Subquantizers <= 0 || q.vectorDim%q.Subquantizers != 0 {
+		return fmt.Errorf("pq vector dimension %d is not divisible by %d subquantizers", q.vectorDim, q.Subquantizers)
+	}
+	if q.Bits < 1 || q.Bits > 8 {
+		return fmt.Errorf("pq bits must be between 1 and 8, got %d", q.Bits)
+	}
+
+	if !q.trained() {
+		return nil
+	}
+	if len(q.Centroids) != q.Subquantizers {
+		return fmt.Errorf("pq has %d codebooks, expected %d", len(q.Centroids), q.Subquantizers)
+	}
+	for _, centroids := range q.Centroids {
+		if len(centroids) != q.centroids()*q.subDim() {
+			return fmt.Errorf("pq codebook has %d values, expected %d", len(centroids), q.centroids()*q.subDim())
+		}
+	}
+
+	return nil
+}
+
+func (q *pqQuantizer) trained() bool {
+	return q.Centroids != nil
+}
+
+// train run k-means on every sub vector in parallel
+func (q *pqQuantizer) train(samples [][]float32) error {
+	if len(samples) < q.centroids() {
+		return fmt.Errorf("pq needs at least %d samples, got %d", q.centroids(), len(samples))
+	}
+
+	centroids := make([][]float32, q.Subquantizers)
+
+	var wg sync.WaitGroup
+	for m := range centroids {
+		wg.Add(1)
+		go func(m int) {
+			defer wg.Done()
+
+			subSamples := make([][]float32, len(samples))
+			for i, sample := range samples {
+				subSamples[i] = sample[m*q.subDim() : (m+1)*q.subDim()]
+			}
+			// seeded so training the same samples gives the same codebooks
+			rng := rand.New(rand.NewSource(int64(m) + 1))
+			centroids[m] = kmeans(subSamples, q.centroids(), pqIterations, rng)
+		}(m)
+	}
+	wg.Wait()
+
+	q.Centroids = centroids
+
+	return nil
+}
+
+// kmeans cluster the vectors into k centroids using L2 distance, the centroids are returned one after another.
+// The centroids start from distinct random vectors, empty cluster restarts from a random vector
+func kmeans(vectors [][]float32, k int, iterations int, rng *rand.Rand) []float32 {
+	dim := len(vectors[0])
+
+	centroids := make([]float32, 0, k*dim)
+	for _, idx := range rng.Perm(len(vectors))[:k] {
+		centroids = append(centroids, vectors[idx]...)
+	}
+
+	assignment := make([]int, len(vectors))
+	counts := make([]int, k)
+	for iteration := 0; iteration < iterations; iteration++ {
+		changed := false
+		for i, vector := range vectors {
+			nearest := nearestCentroid(centroids, dim, vector)
+			if nearest != assignment[i] || iteration == 0 {
+				assignment[i] = nearest
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		clear(centroids)
+		clear(counts)
+		for i, vector := range vectors {
+			centroid := centroids[assignment[i]*dim : (assignment[i]+1)*dim]
+			for j := range vector {
+				centroid[j] += vector[j]
+			}
+			counts[assignment[i]]++
+		}
+
+		for c, count := range counts {
+			centroid := centroids[c*dim : (c+1)*dim]
+			if count == 0 {
+				copy(centroid, vectors[rng.Intn(len(vectors))])
+				continue
+			}
+			for j := range centroid {
+				centroid[j] /= float32(count)
+			}
+		}
+	}
+
+	return centroids
+}
+
+// nearestCentroid return the index of the centroid nearest to the vector
+func nearestCentroid(centroids []float32, dim int, vector []float32) int {
+	nearest := 0
+	nearestDistance := float32(math.MaxFloat32)
+	for c := 0; c*dim < len(centroids); c++ {
+		distance := l2SquaredKernel(vector, centroids[c*dim:(c+1)*dim])
+		if distance < nearestDistance {
+			nearest = c
+			nearestDistance = distance
+		}
+	}
+
+	return nearest
+}
+
+func (q *pqQuantizer) encode(vector []float32) []byte {
+	code := make([]byte, q.codeSize())
+	subDim := q.subDim()
+	for m, centroids := range q.Centroids {
+		q.setIndex(code, m, nearestCentroid(centroids, subDim, vector[m*subDim:(m+1)*subDim]))
+	}
+
+	return code
+}
+
+func (q *pqQuantizer) decode(code []byte) []float32 {
+	return q.decodeInto(code, make([]float32, q.vectorDim))
+}
+
+func (q *pqQuantizer) decodeInto(code []byte, vector []float32) []float32 {
+	subDim := q.subDim()
+	for m, centroids := range q.Centroids {
+		idx := q.index(code, m)
+		copy(vector[m*subDim:], centroids[idx*subDim:(idx+1)*subDim])
+	}
+
+	return vector
+}
+
+// index read the centroid index of sub vector m, the index spans at most 2 bytes as Bits <= 8
+func (q *pqQuantizer) index(code []byte, m int) int {
+	if q.Bits == 8 {
+		return int(code[m])
+	}
+
+	bit := m * q.Bits
+	word := uint(code[bit/8])
+	if bit/8+1 < len(code) {
+		word |= uint(code[bit/8+1]) << 8
+	}
+
+	return int(word>>(bit%8)) & (q.centroids() - 1)
+}
+
+// setIndex write the centroid index of sub vector m, the code must be zero there
+func (q *pqQuantizer) setIndex(code []byte, m int, idx int) {
+	if q.Bits == 8 {
+		code[m] = byte(idx)
+		return
+	}
+
+	bit := m * q.Bits
+	word := uint(idx) << (bit % 8)
+	code[bit/8] |= byte(word)
+	if bit/8+1 < len(code) {
+		code[bit/8+1] |= byte(word >> 8)
+	}
+}
+
+// queryDistance build the asymmetric distance table of the query,
+// L2 and inner product are sums over the sub vectors so the distance to a code is a sum of table lookups
+func (q *pqQuantizer) queryDistance(query []float32) codeDistance {
+	var subDistance func(vec1, vec2 []float32) float32
+	sqrt := false
+	switch q.distance.(type) {
+	case *L2SquaredDistance:
+		subDistance = l2SquaredKernel
+	case *L2Distance:
+		subDistance = l2SquaredKernel
+		sqrt = true
+	case *InnerProductDistance:
+		subDistance = func(vec1, vec2 []float32) float32 { return -dotKernel(vec1, vec2) }
+	default:
+		return newDecodedDistance(q, q.distance, query)
+	}
+
+	k := q.centroids()
+	subDim := q.subDim()
+	table := make([]float32, q.Subquantizers*k)
+	for m, centroids := range q.Centroids {
+		subQuery := query[m*subDim : (m+1)*subDim]
+		for c := 0; c < k; c++ {
+			table[m*k+c] = subDistance(subQuery, centroids[c*subDim:(c+1)*subDim])
+		}
+	}
+
+	return &pqTableDistance{quantizer: q, table: table, sqrt: sqrt}
+}
+
+// nodeDistance decode the codes, building the table costs as much as 1<<Bits distances
+func (q *pqQuantizer) nodeDistance(code []byte) codeDistance {
+	return newDecodedDistance(q, q.distance, q.decode(code))
+}
+
+// pqTableDistance is the asymmetric distance computation (ADC), table[m*k+c] is the distance
+// between sub vector m of the query and centroid c
+type pqTableDistance struct {
+	quantizer *pqQuantizer
+	table     []float32
+	sqrt      bool
+}
+
+func (d *pqTableDistance) distance(code []byte) float32 {
+	var sum float32
+	q := d.quantizer
+	k := q.centroids()
+	if q.Bits == 8 {
+		for m, idx := range code {
+			sum += d.table[m*k+int(idx)]
+		}
+	} else {
+		for m := 0; m < q.Subquantizers; m++ {
+			sum += d.table[m*k+q.index(code, m)]
+		}
+	}
+
+	if d.sqrt {
+		return float32(math.Sqrt(float64(max(sum, 0))))
+	}
+	return sum
+}
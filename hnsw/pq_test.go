@@ -0,0 +1,167 @@
+package hnsw
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPQQuantizer_index(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	for bits := 1; bits <= 8; bits++ {
+		q := newPQQuantizer(14, 7, bits, &L2Distance{})
+		code := make([]byte, q.codeSize())
+		indexes := make([]int, q.Subquantizers)
+		for m := range indexes {
+			indexes[m] = rng.Intn(q.centroids())
+			q.setIndex(code, m, indexes[m])
+		}
+
+		for m, expected := range indexes {
+			if got := q.index(code, m); got != expected {
+				t.Errorf("bits %d: expected index %d of sub vector %d, got %d", bits, expected, m, got)
+			}
+		}
+	}
+}
+
+func TestPQQuantizer(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	samples := randomVectors(rng, 500, 16)
+
+	if err := newPQQuantizer(16, 4, 8, &L2Distance{}).train(samples[:100]); err == nil {
+		t.Errorf("expected error training 256 centroids on 100 samples")
+	}
+
+	// the distance on codes is the distance to the decoded vector, whatever the distance computer does
+	for _, distance := range []DistanceComputer{&L2Distance{}, &L2SquaredDistance{}, &InnerProductDistance{}, &CosineDistance{}} {
+		q := newPQQuantizer(16, 4, 5, distance)
+		if err := q.train(samples); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// a centroid is encoded as itself
+		centroid := q.decode(q.encode(samples[0]))
+		if decoded := q.decode(q.encode(centroid)); !slices.Equal(decoded, centroid) {
+			t.Errorf("%s: expected centroid %v, got %v", distance.GetName(), centroid, decoded)
+		}
+
+		query := randomVectors(rng, 1, 16)[0]
+		queryDistance := q.queryDistance(query)
+		for _, sample := range samples[:10] {
+			code := q.encode(sample)
+			expected := distance.CalcDistance(query, q.decode(code))
+			if got := queryDistance.distance(code); abs(got-expected) > 1e-4 {
+				t.Errorf("%s: expected %v, got %v", distance.GetName(), expected, got)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on vector dimension not divisible by subquantizers")
+		}
+	}()
+	NewHNSW(HNSWOption{VectorDim: 10, Quantization: QuantizationPQ, PQSubquantizers: 4})
+}
+
+func TestHNSW_PQ(t *testing.T) {
+	const dim = 32
+
+	rng := rand.New(rand.NewSource(23))
+	vectors := randomVectors(rng, 2000, dim)
+	queries := randomVectors(rng, 50, dim)
+
+	h := NewHNSW(HNSWOption{
+		M:               16,
+		EfConstruction:  100,
+		EfSearch:        50,
+		VectorDim:       dim,
+		Quantization:    QuantizationPQ,
+		PQSubquantizers: 16,
+		RerankFactor:    4,
+
+		RNG: rand.New(rand.NewSource(24)),
+	})
+	if err := h.Train(vectors); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := h.AddVectors(vectors, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := len(h.codes.get(0)); size != 16 {
+		t.Errorf("expected 16 bytes code, got %d", size)
+	}
+	// encoded by the insert workers
+	for idx, id := range ids {
+		if !slices.Equal(h.codes.get(id), h.quantizer.encode(vectors[idx])) {
+			t.Fatalf("node %d: code doesn't match its vector", id)
+		}
+	}
+
+	if recall := recallAt(h, vectors, ids, queries, 10); recall < 0.8 {
+		t.Errorf("expected recall@10 at least 0.8, got %v", recall)
+	}
+
+	// the codebooks and the codes are saved, search gives the same result after loading
+	path := filepath.Join(t.TempDir(), "index.db")
+	if err := h.SaveToDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries[:10] {
+		expectedIDs, expectedDistances, _ := h.Search(query, 10)
+		gotIDs, gotDistances, _ := loaded.Search(query, 10)
+		if !slices.Equal(expectedIDs, gotIDs) || !slices.Equal(expectedDistances, gotDistances) {
+			t.Fatalf("search differs after loading\n%v %v\n%v %v", expectedIDs, expectedDistances, gotIDs, gotDistances)
+		}
+	}
+}
+
+// BenchmarkHNSW_PQ report the recall of PQ without rerank at various code sizes
+func BenchmarkHNSW_PQ(b *testing.B) {
+	const dim = 64
+
+	rng := rand.New(rand.NewSource(25))
+	vectors := randomVectors(rng, 5000, dim)
+	queries := randomVectors(rng, 100, dim)
+
+	for _, config := range []struct{ subquantizers, bits int }{{8, 8}, {16, 4}, {16, 8}, {32, 8}, {64, 8}} {
+		h := NewHNSW(HNSWOption{
+			M:                16,
+			EfConstruction:   100,
+			EfSearch:         50,
+			VectorDim:        dim,
+			Quantization:     QuantizationPQ,
+			PQSubquantizers:  config.subquantizers,
+			PQBits:           config.bits,
+			DistanceComputer: &L2SquaredDistance{},
+
+			RNG: rand.New(rand.NewSource(26)),
+		})
+		h.Train(vectors)
+		ids, _ := h.AddVectors(vectors, 0)
+
+		name := fmt.Sprintf("m=%d,bits=%d", config.subquantizers, config.bits)
+		b.Run(name, func(b *testing.B) {
+			recall := recallAt(h, vectors, ids, queries, 10)
+			b.ReportAllocs()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.Search(queries[i%len(queries)], 10)
+			}
+			b.ReportMetric(recall, "recall@10")
+			b.ReportMetric(float64(len(h.codes.get(0))), "bytes/vector")
+		})
+	}
+}
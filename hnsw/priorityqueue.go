@@ -1,92 +1,91 @@
 package hnsw
 
-import (
-	"container/heap"
-)
-
 // An pqItem is something we manage in a priority queue.
 type pqItem struct {
 	Value    int     // The value of the item;
 	Priority float32 // The priority of the item in the queue.
-	// The index is needed by update and is maintained by the heap.Interface methods.
-	index int // The index of the item in the heap.
 }
 
-// A priorityQueue implements heap.Interface and holds Items.
-type priorityQueueMax []*pqItem
-type priorityQueueMin []*pqItem
-
-func (pq priorityQueueMax) Len() int { return len(pq) }
-func (pq priorityQueueMin) Len() int { return len(pq) }
-
-func (pq priorityQueueMax) Less(i, j int) bool {
-	// We want Pop to give us the highest, not lowest, priority so we use greater than here.
-	return pq[i].Priority > pq[j].Priority
+// priorityQueue is a binary heap holding the items by value.
+// Unlike container/heap the items are not boxed into any,
+// so Push doesn't allocate as long as the capacity is enough.
+// less(a, b) reports whether a must be popped before b
+type priorityQueue[T any] struct {
+	items []T
+	less  func(a, b T) bool
 }
 
-func (pq priorityQueueMin) Less(i, j int) bool {
-	// We want Pop to give us the lowest
-	return pq[i].Priority < pq[j].Priority
+func newPriorityQueue[T any](size int, less func(a, b T) bool) priorityQueue[T] {
+	return priorityQueue[T]{
+		items: make([]T, 0, size),
+		less:  less,
+	}
 }
 
-func (pq priorityQueueMax) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].index = i
-	pq[j].index = j
+// newPriorityQueueMax create a queue that pops the highest priority first
+func newPriorityQueueMax(size int) priorityQueue[pqItem] {
+	return newPriorityQueue(size, func(a, b pqItem) bool {
+		return a.Priority > b.Priority
+	})
 }
 
-func (pq priorityQueueMin) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].index = i
-	pq[j].index = j
+// newPriorityQueueMin create a queue that pops the lowest priority first
+func newPriorityQueueMin(size int) priorityQueue[pqItem] {
+	return newPriorityQueue(size, func(a, b pqItem) bool {
+		return a.Priority < b.Priority
+	})
 }
 
-func (pq *priorityQueueMax) Push(x any) {
-	n := len(*pq)
-	item := x.(*pqItem)
-	item.index = n
-	*pq = append(*pq, item)
-}
+func (pq *priorityQueue[T]) Len() int { return len(pq.items) }
 
-func (pq *priorityQueueMin) Push(x any) {
-	n := len(*pq)
-	item := x.(*pqItem)
-	item.index = n
-	*pq = append(*pq, item)
-}
+// Top return the item that will be popped next without removing it, the queue must not be empty
+func (pq *priorityQueue[T]) Top() T { return pq.items[0] }
 
-func (pq *priorityQueueMax) Pop() any {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil  // don't stop the GC from reclaiming the item eventually
-	item.index = -1 // for safety
-	*pq = old[0 : n-1]
-	return item
+func (pq *priorityQueue[T]) Push(item T) {
+	pq.items = append(pq.items, item)
+	pq.up(len(pq.items) - 1)
 }
 
-func (pq *priorityQueueMin) Pop() any {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil  // don't stop the GC from reclaiming the item eventually
-	item.index = -1 // for safety
-	*pq = old[0 : n-1]
-	return item
+// Pop remove and return the top item, the queue must not be empty
+func (pq *priorityQueue[T]) Pop() T {
+	n := len(pq.items) - 1
+	top := pq.items[0]
+	pq.items[0] = pq.items[n]
+	pq.items = pq.items[:n]
+	pq.down(0)
+	return top
 }
 
-func newPriorityQueueMax(size int) priorityQueueMax {
-	pq := make(priorityQueueMax, 0, size)
-
-	heap.Init(&pq)
-
-	return pq
+// Reset empty the queue and keep the capacity
+func (pq *priorityQueue[T]) Reset() {
+	pq.items = pq.items[:0]
 }
 
-func newPriorityQueueMin(size int) priorityQueueMin {
-	pq := make(priorityQueueMin, 0, size)
-
-	heap.Init(&pq)
+func (pq *priorityQueue[T]) up(idx int) {
+	for idx > 0 {
+		parent := (idx - 1) / 2
+		if !pq.less(pq.items[idx], pq.items[parent]) {
+			break
+		}
+		pq.items[idx], pq.items[parent] = pq.items[parent], pq.items[idx]
+		idx = parent
+	}
+}
 
-	return pq
+func (pq *priorityQueue[T]) down(idx int) {
+	n := len(pq.items)
+	for {
+		child := 2*idx + 1
+		if child >= n {
+			break
+		}
+		if right := child + 1; right < n && pq.less(pq.items[right], pq.items[child]) {
+			child = right
+		}
+		if !pq.less(pq.items[child], pq.items[idx]) {
+			break
+		}
+		pq.items[idx], pq.items[child] = pq.items[child], pq.items[idx]
+		idx = child
+	}
 }
@@ -1,22 +1,21 @@
 package hnsw
 
 import (
-	"container/heap"
 	"testing"
 )
 
 func TestPriorityQueueMax_Basic(t *testing.T) {
 	pq := newPriorityQueueMax(0)
 
-	heap.Push(&pq, &pqItem{Value: 1, Priority: 2.0})
-	heap.Push(&pq, &pqItem{Value: 2, Priority: 5.0})
-	heap.Push(&pq, &pqItem{Value: 3, Priority: 1.0})
-	heap.Push(&pq, &pqItem{Value: 4, Priority: 3.0})
+	pq.Push(pqItem{Value: 1, Priority: 2.0})
+	pq.Push(pqItem{Value: 2, Priority: 5.0})
+	pq.Push(pqItem{Value: 3, Priority: 1.0})
+	pq.Push(pqItem{Value: 4, Priority: 3.0})
 
 	// Should pop in order of highest priority first
 	expectedOrder := []int{2, 4, 1, 3}
 	for i, expected := range expectedOrder {
-		item := heap.Pop(&pq).(*pqItem)
+		item := pq.Pop()
 		if item.Value != expected {
 			t.Errorf("pop %d: expected value %d, got %d", i, expected, item.Value)
 		}
@@ -30,15 +29,15 @@ func TestPriorityQueueMax_Basic(t *testing.T) {
 func TestPriorityQueueMin_Basic(t *testing.T) {
 	pq := newPriorityQueueMin(0)
 
-	heap.Push(&pq, &pqItem{Value: 3, Priority: 3.0})
-	heap.Push(&pq, &pqItem{Value: 4, Priority: 4.0})
-	heap.Push(&pq, &pqItem{Value: 1, Priority: 1.0})
-	heap.Push(&pq, &pqItem{Value: 2, Priority: 2.0})
+	pq.Push(pqItem{Value: 3, Priority: 3.0})
+	pq.Push(pqItem{Value: 4, Priority: 4.0})
+	pq.Push(pqItem{Value: 1, Priority: 1.0})
+	pq.Push(pqItem{Value: 2, Priority: 2.0})
 
 	// Should pop in order of lowest priority first
 	expectedOrder := []int{1, 2, 3, 4}
 	for i, expected := range expectedOrder {
-		item := heap.Pop(&pq).(*pqItem)
+		item := pq.Pop()
 		if item.Value != expected {
 			t.Errorf("pop %d: expected value %d, got %d", i, expected, item.Value)
 		}
@@ -48,3 +47,32 @@ func TestPriorityQueueMin_Basic(t *testing.T) {
 		t.Errorf("expected empty queue after pops, got len %d", pq.Len())
 	}
 }
+
+func TestPriorityQueueMin_Random(t *testing.T) {
+	pq := newPriorityQueueMin(0)
+
+	priorities := []float32{5, 3, 9, 1, 1, 7, 2, 8, 6, 4, 0, 3}
+	for i, priority := range priorities {
+		pq.Push(pqItem{Value: i, Priority: priority})
+	}
+
+	if top := pq.Top(); top.Priority != 0 {
+		t.Errorf("expected top priority 0, got %v", top.Priority)
+	}
+
+	var last float32 = -1
+	for pq.Len() > 0 {
+		item := pq.Pop()
+		if item.Priority < last {
+			t.Fatalf("popped %v after %v", item.Priority, last)
+		}
+		last = item.Priority
+	}
+
+	// reuse after reset
+	pq.Push(pqItem{Value: 1, Priority: 1})
+	pq.Reset()
+	if pq.Len() != 0 {
+		t.Errorf("expected empty queue after reset, got len %d", pq.Len())
+	}
+}
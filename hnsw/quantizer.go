@@ -0,0 +1,194 @@
+package hnsw
+
+import (
+	"fmt"
+)
+
+const (
+	// QuantizationNone store the float32 vectors as is
+	QuantizationNone = ""
+	// QuantizationSQ8 store every dimension as uint8 scaled between the trained min and max of the dimension,
+	// it's 4 times smaller than float32
+	QuantizationSQ8 = "sq8"
+	// QuantizationPQ store the vector as PQSubquantizers centroid indexes of PQBits each, learned by k-means.
+	// 128 dimensions with 16 subquantizers of 8 bits is 16 bytes instead of 512
+	QuantizationPQ = "pq"
+	// QuantizationBinary store the sign bit of every dimension, it's 32 times smaller than float32.
+	// The search uses the Hamming distance between the bits, it works best on high dimension embeddings
+	// centered around zero with RerankFactor to rerank the oversampled candidates
+	QuantizationBinary = "binary"
+	// QuantizationFloat16 store every dimension as IEEE 754 half precision, 2 times smaller than float32.
+	// The range is limited to 65504 and the precision to 11 bits
+	QuantizationFloat16 = "float16"
+	// QuantizationBFloat16 store every dimension as bfloat16, 2 times smaller than float32.
+	// It keeps the float32 range with 8 bits of precision
+	QuantizationBFloat16 = "bfloat16"
+)
+
+// quantizer compress the vectors into codes, the graph is built and traversed using the codes.
+// Every quantizer is a quantizer of float32
+type quantizer[T Element] interface {
+	// train learn the parameters from the samples, it must be called before encode
+	train(samples [][]T) error
+	trained() bool
+	// validate check the parameters, the trained ones are only checked once trained
+	validate() error
+
+	// codeSize is the number of bytes of every code, it's known before training
+	codeSize() int
+	encode(vector []T) []byte
+	// decode return the approximation of the encoded vector
+	decode(code []byte) []T
+	// decodeInto is decode into vector, it returns vector
+	decodeInto(code []byte, vector []T) []T
+
+	// queryDistance prepare the query once, so computing the distance to every code is cheap
+	queryDistance(query []T) codeDistance
+	// nodeDistance prepare the distance from a stored code, it's used between nodes
+	// where only a few distances are computed, so preparing must be cheap
+	nodeDistance(code []byte) codeDistance
+}
+
+// codeDistance is the distance from a prepared query to the codes
+type codeDistance interface {
+	distance(code []byte) float32
+}
+
+// decodedDistance decode the code and use the distance computer, it works with every distance
+type decodedDistance struct {
+	quantizer            quantizer[float32]
+	distanceComputerFunc DistanceComputer
+	query                []float32
+	decoded              []float32
+}
+
+func newDecodedDistance(q quantizer[float32], distance DistanceComputer, query []float32) *decodedDistance {
+	return &decodedDistance{quantizer: q, distanceComputerFunc: distance, query: query, decoded: make([]float32, len(query))}
+}
+
+func (d *decodedDistance) distance(code []byte) float32 {
+	return d.distanceComputerFunc.CalcDistance(d.query, d.quantizer.decodeInto(code, d.decoded))
+}
+
+// newQuantizer create the untrained quantizer of option.Quantization, nil for QuantizationNone.
+// The parameters are not checked, call validate
+func newQuantizer[T Element](option GenericHNSWOption[T], distance GenericDistanceComputer[T]) (quantizer[T], error) {
+	if option.Quantization == QuantizationNone {
+		return nil, nil
+	}
+	if !isFloat32[T]() {
+		return nil, fmt.Errorf("quantization of %s vectors is not supported, only float32", elementType[T]())
+	}
+	float32Distance := any(distance).(DistanceComputer)
+
+	var q quantizer[float32]
+	switch option.Quantization {
+	case QuantizationSQ8:
+		q = newSQ8Quantizer(option.VectorDim, float32Distance)
+	case QuantizationPQ:
+		q = newPQQuantizer(option.VectorDim, option.PQSubquantizers, option.PQBits, float32Distance)
+	case QuantizationBinary:
+		q = newBinaryQuantizer(option.VectorDim)
+	case QuantizationFloat16, QuantizationBFloat16:
+		q = newHalfQuantizer(option.VectorDim, option.Quantization == QuantizationBFloat16, float32Distance)
+	default:
+		return nil, fmt.Errorf("unknown quantization %q", option.Quantization)
+	}
+
+	return any(q).(quantizer[T]), nil
+}
+
+// Train learn the quantizer parameters from the samples, it must be called before adding vectors
+// when HNSWOption.Quantization is set, except QuantizationBinary, QuantizationFloat16
+// and QuantizationBFloat16 which have nothing to learn.
+// The samples should represent the vectors that will be added
+func (h *GenericHNSW[T]) Train(samples [][]T) error {
+	if h.quantizer == nil {
+		return fmt.Errorf("Train : the index is not quantized")
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("Train : no sample")
+	}
+	for _, sample := range samples {
+		if len(sample) != h.vectorDim {
+			return fmt.Errorf("Train : Different vector dimension. Got %d expected %d", len(sample), h.vectorDim)
+		}
+	}
+
+	if h.normalizeVector {
+		normalized := make([][]T, 0, len(samples))
+		for _, sample := range samples {
+			normalized = append(normalized, normalize(sample))
+		}
+		samples = normalized
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// the codes already stored would be meaningless with the new parameters
+	if h.nodes.len() > 0 {
+		return fmt.Errorf("Train : the index already has %d vectors", h.nodes.len())
+	}
+
+	err := h.quantizer.train(samples)
+	if err != nil {
+		return fmt.Errorf("Train : %w", err)
+	}
+
+	return nil
+}
+
+// nodeDistance compute the distance from a query to the nodes of the graph,
+// on the codes when the vectors are quantized
+type nodeDistance[T Element] struct {
+	h     *GenericHNSW[T]
+	query []T // nil when prepared from a quantized node
+
+	codes   codeDistance                      // nil when not quantized
+	bounded GenericBoundedDistanceComputer[T] // nil when the distance is not bounded or quantized
+}
+
+// distanceFrom prepare the query for computing its distance to the nodes
+func (h *GenericHNSW[T]) distanceFrom(query []T) *nodeDistance[T] {
+	d := &nodeDistance[T]{h: h, query: query}
+	if h.quantizer != nil {
+		d.codes = h.quantizer.queryDistance(query)
+	} else {
+		d.bounded, _ = h.distanceComputerFunc.(GenericBoundedDistanceComputer[T])
+	}
+
+	return d
+}
+
+// distanceFromNode prepare the node for computing its distance to the other nodes
+func (h *GenericHNSW[T]) distanceFromNode(id int) *nodeDistance[T] {
+	if h.quantizer == nil {
+		return h.distanceFrom(h.vectors.get(id))
+	}
+
+	return &nodeDistance[T]{h: h, codes: h.quantizer.nodeDistance(h.codes.get(id))}
+}
+
+func (d *nodeDistance[T]) distance(id int) float32 {
+	if d.codes != nil {
+		return d.codes.distance(d.h.codes.get(id))
+	}
+
+	return d.h.distanceComputerFunc.CalcDistance(d.query, d.h.vectors.get(id))
+}
+
+// distanceBounded may stop once the distance exceeds bound, see BoundedDistanceComputer
+func (d *nodeDistance[T]) distanceBounded(id int, bound float32) float32 {
+	if d.bounded != nil {
+		return d.bounded.CalcDistanceBounded(d.query, d.h.vectors.get(id), bound)
+	}
+
+	return d.distance(id)
+}
+
+// exactDistance use the float32 vector even when the vectors are quantized,
+// it's only possible when the vectors are kept for reranking
+func (d *nodeDistance[T]) exactDistance(id int) float32 {
+	return d.h.distanceComputerFunc.CalcDistance(d.query, d.h.vectors.get(id))
+}
@@ -0,0 +1,278 @@
+package hnsw
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// SearchOptions is the per query parameters of SearchWithOptions,
+// so a query can trade latency for recall without affecting the others
+type SearchOptions struct {
+	TopK int
+
+	// EfSearch is the size of the candidate list on level 0, larger is slower but more accurate.
+	// 0 means HNSW.EfSearch, it's raised to TopK when lower
+	EfSearch int
+
+	// Filter only admit matching node into the result, nil match every node.
+	// See SearchWithFilter
+	Filter func(id int) bool
+
+	// IncludeVectors copy the stored vector into the result.
+	// The vector is normalized when the index normalize vector
+	IncludeVectors bool
+
+	// Stats is filled with the statistic of the search when not nil
+	Stats *SearchStats
+	// Explain record the traversal path into Stats.Path, it's only used when Stats is set
+	Explain bool
+}
+
+// SearchStats describe how a search went through the graph,
+// it helps to tell whether poor recall comes from poor connectivity or a too small beam
+type SearchStats struct {
+	EntryPoint           int   // node the search started from, -1 on empty graph
+	DistanceComputations int   // number of distance computed, including the entry point
+	VisitedPerLevel      []int // number of nodes visited on each level, index is the level
+	Hops                 int   // number of nodes expanded on every level
+	BeamSize             int   // number of nodes found on level 0 before cutting to TopK
+
+	// Path is the expanded nodes in order, only recorded with SearchOptions.Explain
+	Path []SearchStep
+}
+
+// SearchStep is a node expanded by the search
+type SearchStep struct {
+	Level    int
+	ID       int
+	Distance float32
+}
+
+// GenericSearchResult is a single result of SearchWithOptions
+type GenericSearchResult[T Element] struct {
+	ID       int
+	Distance float32
+	Vector   []T // only set when SearchOptions.IncludeVectors is true
+}
+
+// SearchResult is the GenericSearchResult of float32 vectors
+type SearchResult = GenericSearchResult[float32]
+
+// SearchWithOptions search the nearest nodes using the given options.
+// The results are sorted by distance, closest first
+func (h *GenericHNSW[T]) SearchWithOptions(VecToSearch []T, options SearchOptions) (results []GenericSearchResult[T], err error) {
+	return h.SearchContext(context.Background(), VecToSearch, options)
+}
+
+// SearchContext is SearchWithOptions that stops when ctx is done.
+// The context is checked on every level and before expanding each candidate.
+// When it fires the nearest nodes found so far are returned together with ctx.Err(),
+// they may be fewer than TopK and less accurate
+func (h *GenericHNSW[T]) SearchContext(ctx context.Context, VecToSearch []T, options SearchOptions) (results []GenericSearchResult[T], err error) {
+	if len(VecToSearch) != h.vectorDim {
+		err = fmt.Errorf("Search : Different vector dimension. Got %d expected %d", len(VecToSearch), h.vectorDim)
+		return
+	}
+
+	// nothing to search, like FlatIndex
+	if options.TopK <= 0 {
+		return
+	}
+
+	if h.normalizeVector {
+		VecToSearch = normalize(VecToSearch)
+	}
+
+	ef := options.EfSearch
+	if ef <= 0 {
+		ef = h.EfSearch
+	}
+	if ef < options.TopK {
+		ef = options.TopK
+	}
+
+	// the codes find more candidates than TopK, so the exact distance can reorder them
+	rerank := h.quantizer != nil && h.rerankFactor > 0
+	if rerank && ef < options.TopK*h.rerankFactor {
+		ef = options.TopK * h.rerankFactor
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	entryPoint, curMaxLevel := h.getEntryPoint()
+
+	if options.Stats != nil {
+		*options.Stats = SearchStats{EntryPoint: entryPoint}
+	}
+
+	// empty graph
+	if entryPoint < 0 {
+		return
+	}
+
+	buf := h.getSearchBuffer()
+	defer h.putSearchBuffer(buf)
+	buf.done = ctx.Done()
+	if options.Stats != nil {
+		options.Stats.DistanceComputations = 1 // the entry point
+		options.Stats.VisitedPerLevel = make([]int, curMaxLevel+1)
+		buf.stats = options.Stats
+		buf.explain = options.Explain
+	}
+
+	query := h.distanceFrom(VecToSearch)
+	candidates := []pqItem{{Value: entryPoint, Priority: query.distance(entryPoint)}}
+
+	// search from the top level until 0
+	for l := curMaxLevel; l >= 0; l-- {
+		// stopped before level 0, the candidates are not filtered yet
+		if buf.stopped() {
+			if options.Filter != nil {
+				candidates = slices.DeleteFunc(candidates, func(item pqItem) bool { return !options.Filter(item.Value) })
+			}
+			break
+		}
+
+		// when level higher than 0, ef is 1
+		if l > 0 {
+			candidates = h.searchLevelInternal(buf, query, candidates, l, 1, nil)
+		} else {
+			candidates = h.searchLevelInternal(buf, query, candidates, l, ef, options.Filter)
+		}
+	}
+
+	if options.Stats != nil {
+		options.Stats.BeamSize = len(candidates)
+	}
+
+	if rerank {
+		candidates = candidates[:min(len(candidates), options.TopK*h.rerankFactor)]
+		for idx := range candidates {
+			candidates[idx].Priority = query.exactDistance(candidates[idx].Value)
+		}
+		slices.SortFunc(candidates, func(a, b pqItem) int {
+			return cmp.Compare(a.Priority, b.Priority)
+		})
+	}
+
+	offset := len(candidates)
+	if offset > options.TopK {
+		offset = options.TopK
+	}
+
+	results = make([]GenericSearchResult[T], 0, offset)
+	for idx := 0; idx < offset; idx++ {
+		result := GenericSearchResult[T]{ID: candidates[idx].Value, Distance: candidates[idx].Priority}
+		if options.IncludeVectors {
+			result.Vector = append([]T(nil), h.vector(result.ID)...)
+		}
+		results = append(results, result)
+	}
+
+	if buf.interrupted {
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// SearchRadius search every node within radius of the query, radius uses the unit of the distance computer.
+// After descending like Search, the level 0 search keeps expanding from the nearest nodes
+// until no candidate inside the radius remains. maxResults <= 0 means no limit.
+// Quantized index needs RerankFactor, the radius is compared to the distance on the kept vectors
+// as the distance on the codes has another unit.
+// The output is sorted by distance, closest is index 0
+func (h *GenericHNSW[T]) SearchRadius(VecToSearch []T, radius float32, maxResults int) (resultNodeID []int, resultDistance []float32, err error) {
+	if len(VecToSearch) != h.vectorDim {
+		err = fmt.Errorf("SearchRadius : Different vector dimension. Got %d expected %d", len(VecToSearch), h.vectorDim)
+		return
+	}
+	if h.quantizer != nil && h.vectors == nil {
+		err = fmt.Errorf("SearchRadius : quantized index without RerankFactor has no distance in the radius unit")
+		return
+	}
+
+	if h.normalizeVector {
+		VecToSearch = normalize(VecToSearch)
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	entryPoint, curMaxLevel := h.getEntryPoint()
+
+	// empty graph
+	if entryPoint < 0 {
+		return
+	}
+
+	buf := h.getSearchBuffer()
+	defer h.putSearchBuffer(buf)
+
+	query := h.distanceFrom(VecToSearch)
+	candidates := []pqItem{{Value: entryPoint, Priority: query.distance(entryPoint)}}
+
+	for l := curMaxLevel; l >= 0; l-- {
+		if l > 0 {
+			candidates = h.searchLevelInternal(buf, query, candidates, l, 1, nil)
+		} else {
+			candidates = h.searchLevelInternal(buf, query, candidates, l, h.EfSearch, nil)
+		}
+	}
+
+	// the distances on the codes are only good for finding the nearest nodes
+	distance := query.distance
+	if h.quantizer != nil {
+		distance = query.exactDistance
+	}
+
+	// expand from the nearest nodes, closest candidate first
+	visited := &buf.visited
+	candidate := &buf.candidate
+	visited.reset(h.nodes.len())
+	candidate.Reset()
+	for _, seed := range candidates {
+		visited.visit(seed.Value)
+		candidate.Push(pqItem{Value: seed.Value, Priority: distance(seed.Value)})
+	}
+
+	var results []pqItem
+	for candidate.Len() > 0 {
+		if maxResults > 0 && len(results) >= maxResults {
+			break
+		}
+
+		toVisit := candidate.Pop()
+
+		// the closest candidate is outside, so is the rest
+		if toVisit.Priority > radius {
+			break
+		}
+
+		results = append(results, toVisit)
+
+		for _, neighbor := range h.neighbors(toVisit.Value, 0) {
+			nodeID := int(neighbor)
+			if visited.visit(nodeID) {
+				continue
+			}
+
+			candidate.Push(pqItem{Value: nodeID, Priority: distance(nodeID)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Priority < results[j].Priority
+	})
+
+	for _, result := range results {
+		resultNodeID = append(resultNodeID, result.Value)
+		resultDistance = append(resultDistance, result.Priority)
+	}
+
+	return
+}
@@ -0,0 +1,209 @@
+package hnsw
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHNSW_SearchWithOptions(t *testing.T) {
+	h, _ := newGridHNSW(t)
+
+	query := []float32{4.2, 4.7}
+
+	results, err := h.SearchWithOptions(query, SearchOptions{TopK: 3, EfSearch: 50, IncludeVectors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	resultNodeID, resultDistance, _ := h.Search(query, 3)
+	for idx, result := range results {
+		if result.ID != resultNodeID[idx] || result.Distance != resultDistance[idx] {
+			t.Errorf("expected %d (%f) at index %d, got %d (%f)", resultNodeID[idx], resultDistance[idx], idx, result.ID, result.Distance)
+		}
+
+		vector := h.vector(result.ID)
+		if len(result.Vector) != len(vector) || result.Vector[0] != vector[0] || result.Vector[1] != vector[1] {
+			t.Errorf("expected vector %v, got %v", vector, result.Vector)
+		}
+	}
+
+	// the returned vector is a copy
+	results[0].Vector[0] = -1
+	if h.vector(results[0].ID)[0] == -1 {
+		t.Errorf("stored vector is modified through the result")
+	}
+
+	// vector is not included by default, and topK larger than EfSearch is still satisfied
+	results, _ = h.SearchWithOptions(query, SearchOptions{TopK: 30, EfSearch: 5})
+	if len(results) != 30 {
+		t.Errorf("expected 30 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Vector != nil {
+			t.Errorf("expected no vector, got %v", result.Vector)
+		}
+	}
+
+	if _, err := h.SearchWithOptions([]float32{1}, SearchOptions{TopK: 1}); err == nil {
+		t.Errorf("expected error on different dimension")
+	}
+
+	for _, topK := range []int{0, -1} {
+		results, err := h.SearchWithOptions(query, SearchOptions{TopK: topK})
+		if err != nil || len(results) != 0 {
+			t.Errorf("topK %d: expected empty result, got %v %v", topK, results, err)
+		}
+	}
+}
+
+func TestHNSW_SearchRadius(t *testing.T) {
+	h, _ := newGridHNSW(t)
+
+	// (4, 4), 4 direct neighbors at 1 and 4 diagonal at 1.41
+	resultNodeID, resultDistance, err := h.SearchRadius([]float32{4, 4}, 1.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultNodeID) != 9 {
+		t.Fatalf("expected 9 results, got %d: %v", len(resultNodeID), resultNodeID)
+	}
+	for idx := range resultDistance {
+		if resultDistance[idx] > 1.5 {
+			t.Errorf("distance %f is outside radius", resultDistance[idx])
+		}
+		if idx > 0 && resultDistance[idx] < resultDistance[idx-1] {
+			t.Errorf("result is not sorted at index %d", idx)
+		}
+	}
+
+	resultNodeID, resultDistance, _ = h.SearchRadius([]float32{4, 4}, 1.5, 3)
+	expected := []float32{0, 1, 1}
+	if len(resultNodeID) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(resultNodeID))
+	}
+	for idx := range expected {
+		if resultDistance[idx] != expected[idx] {
+			t.Errorf("expected distance %f at index %d, got %f", expected[idx], idx, resultDistance[idx])
+		}
+	}
+
+	resultNodeID, _, _ = h.SearchRadius([]float32{100, 100}, 1, 0)
+	if len(resultNodeID) != 0 {
+		t.Errorf("expected no result, got %v", resultNodeID)
+	}
+}
+
+func TestHNSW_SearchContext(t *testing.T) {
+	h, _ := newGridHNSW(t)
+
+	query := []float32{4.2, 4.7}
+	options := SearchOptions{TopK: 5, EfSearch: 50}
+
+	// a live context gives the same result as SearchWithOptions
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	results, err := h.SearchContext(ctx, query, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := h.SearchWithOptions(query, options)
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for idx := range results {
+		if results[idx].ID != expected[idx].ID || results[idx].Distance != expected[idx].Distance {
+			t.Errorf("expected %v at index %d, got %v", expected[idx], idx, results[idx])
+		}
+	}
+
+	// cancelled in the middle of level 0, the nodes found so far are returned
+	ctx, cancel = context.WithCancel(context.Background())
+	evaluated := 0
+	options.Filter = func(id int) bool {
+		evaluated++
+		if evaluated == 10 {
+			cancel()
+		}
+		return true
+	}
+	results, err = h.SearchContext(ctx, query, options)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) == 0 || len(results) > options.TopK {
+		t.Fatalf("expected partial results, got %d", len(results))
+	}
+	for idx := 1; idx < len(results); idx++ {
+		if results[idx].Distance < results[idx-1].Distance {
+			t.Errorf("results are not sorted: %v", results)
+		}
+	}
+
+	// already expired, only the entry point is known
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	results, err = h.SearchContext(ctx, query, SearchOptions{TopK: 5, Filter: func(id int) bool { return false }})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no result matching the filter, got %v", results)
+	}
+}
+
+func TestHNSW_SearchStats(t *testing.T) {
+	h, _ := newGridHNSW(t)
+
+	query := []float32{4.2, 4.7}
+
+	var stats SearchStats
+	results, err := h.SearchWithOptions(query, SearchOptions{TopK: 5, EfSearch: 20, Stats: &stats})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryPoint, curMaxLevel := h.getEntryPoint()
+	if stats.EntryPoint != entryPoint {
+		t.Errorf("expected entry point %d, got %d", entryPoint, stats.EntryPoint)
+	}
+	if len(stats.VisitedPerLevel) != curMaxLevel+1 {
+		t.Fatalf("expected %d levels, got %d", curMaxLevel+1, len(stats.VisitedPerLevel))
+	}
+	visited := 0
+	for level, count := range stats.VisitedPerLevel {
+		if count == 0 {
+			t.Errorf("expected visited nodes on level %d", level)
+		}
+		visited += count
+	}
+	// every visited node has its distance computed once, except the entries of the levels below the top
+	if stats.DistanceComputations != visited-curMaxLevel {
+		t.Errorf("expected %d distance computations, got %d", visited-curMaxLevel, stats.DistanceComputations)
+	}
+	if stats.BeamSize != 20 || len(results) != 5 {
+		t.Errorf("expected beam 20 and 5 results, got %d and %d", stats.BeamSize, len(results))
+	}
+	if stats.Hops == 0 || stats.Path != nil {
+		t.Errorf("expected hops without path, got %d hops and %v", stats.Hops, stats.Path)
+	}
+
+	// explain record every hop, starting from the entry point and going down
+	var explained SearchStats
+	h.SearchWithOptions(query, SearchOptions{TopK: 5, EfSearch: 20, Stats: &explained, Explain: true})
+	if len(explained.Path) != explained.Hops || explained.Hops != stats.Hops {
+		t.Fatalf("expected %d steps, got %d", stats.Hops, len(explained.Path))
+	}
+	if first := explained.Path[0]; first.ID != entryPoint || first.Level != curMaxLevel {
+		t.Errorf("expected path to start at %d on level %d, got %v", entryPoint, curMaxLevel, first)
+	}
+	for idx := 1; idx < len(explained.Path); idx++ {
+		if explained.Path[idx].Level > explained.Path[idx-1].Level {
+			t.Errorf("expected path going down, got %v", explained.Path)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package hnsw
+
+import (
+	"fmt"
+	"math"
+)
+
+// sq8Quantizer is the scalar quantizer of QuantizationSQ8.
+// Every dimension is mapped linearly from [Min, Min+255*Scale] to [0, 255],
+// value outside of the trained range is clamped
+type sq8Quantizer struct {
+	Min   []float32
+	Scale []float32
+
+	vectorDim int
+	distance  DistanceComputer
+}
+
+func newSQ8Quantizer(vectorDim int, distance DistanceComputer) *sq8Quantizer {
+	return &sq8Quantizer{vectorDim: vectorDim, distance: distance}
+}
+
+// train use the min and max of every dimension
+func (q *sq8Quantizer) train(samples [][]float32) error {
+	minimum := append([]float32(nil), samples[0]...)
+	maximum := append([]float32(nil), samples[0]...)
+	for _, sample := range samples[1:] {
+		for i, value := range sample {
+			minimum[i] = min(minimum[i], value)
+			maximum[i] = max(maximum[i], value)
+		}
+	}
+
+	scale := make([]float32, q.vectorDim)
+	for i := range scale {
+		scale[i] = (maximum[i] - minimum[i]) / math.MaxUint8
+	}
+
+	q.Min = minimum
+	q.Scale = scale
+
+	return nil
+}
+
+func (q *sq8Quantizer) trained() bool {
+	return q.Min != nil
+}
+
+func (q *sq8Quantizer) validate() error {
+	if !q.trained() {
+		return nil
+	}
+	if len(q.Min) != q.vectorDim || len(q.Scale) != q.vectorDim {
+		return fmt.Errorf("sq8 quantizer has %d min and %d scale, expected %d", len(q.Min), len(q.Scale), q.vectorDim)
+	}
+	return nil
+}
+
+func (q *sq8Quantizer) codeSize() int {
+	return q.vectorDim
+}
+
+func (q *sq8Quantizer) encode(vector []float32) []byte {
+	code := make([]byte, q.codeSize())
+	for i, value := range vector {
+		// constant dimension, every value is Min
+		if q.Scale[i] == 0 {
+			continue
+		}
+
+		level := math.Round(float64((value - q.Min[i]) / q.Scale[i]))
+		code[i] = byte(min(max(level, 0), math.MaxUint8))
+	}
+
+	return code
+}
+
+func (q *sq8Quantizer) decode(code []byte) []float32 {
+	return q.decodeInto(code, make([]float32, q.vectorDim))
+}
+
+func (q *sq8Quantizer) decodeInto(code []byte, vector []float32) []float32 {
+	for i, level := range code {
+		vector[i] = q.Min[i] + q.Scale[i]*float32(level)
+	}
+
+	return vector
+}
+
+func (q *sq8Quantizer) queryDistance(query []float32) codeDistance {
+	switch q.distance.(type) {
+	case *L2SquaredDistance:
+		return newSQ8L2Distance(q, query, false)
+	case *L2Distance:
+		return newSQ8L2Distance(q, query, true)
+	default:
+		return newDecodedDistance(q, q.distance, query)
+	}
+}
+
+func (q *sq8Quantizer) nodeDistance(code []byte) codeDistance {
+	return newDecodedDistance(q, q.distance, q.decode(code))
+}
+
+// sq8L2Distance compute the L2 distance directly on the codes,
+// the query is shifted by Min once so every dimension costs a multiply add
+type sq8L2Distance struct {
+	shifted []float32 // query - Min
+	scale   []float32
+	sqrt    bool
+}
+
+func newSQ8L2Distance(q *sq8Quantizer, query []float32, sqrt bool) *sq8L2Distance {
+	shifted := make([]float32, len(query))
+	for i := range query {
+		shifted[i] = query[i] - q.Min[i]
+	}
+
+	return &sq8L2Distance{shifted: shifted, scale: q.Scale, sqrt: sqrt}
+}
+
+func (d *sq8L2Distance) distance(code []byte) float32 {
+	var sumOfSquares float32
+	scale := d.scale[:len(code)]
+	shifted := d.shifted[:len(code)]
+	for i, level := range code {
+		diff := shifted[i] - scale[i]*float32(level)
+		sumOfSquares += diff * diff
+	}
+
+	if d.sqrt {
+		return float32(math.Sqrt(float64(sumOfSquares)))
+	}
+	return sumOfSquares
+}
@@ -0,0 +1,138 @@
+package hnsw
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSQ8Quantizer(t *testing.T) {
+	q := newSQ8Quantizer(3, &L2Distance{})
+	q.train([][]float32{{0, -1, 5}, {10, 1, 5}, {5, 0, 5}})
+
+	// the error is at most half a step, the last dimension is constant
+	for _, vector := range [][]float32{{0, -1, 5}, {3.3, 0.25, 5}, {10, 1, 5}} {
+		decoded := q.decode(q.encode(vector))
+		for i := range vector {
+			if abs(decoded[i]-vector[i]) > q.Scale[i]/2+1e-6 {
+				t.Errorf("dimension %d of %v decoded to %v", i, vector, decoded[i])
+			}
+		}
+	}
+
+	// outside of the trained range is clamped
+	if code := q.encode([]float32{-5, 2, 0}); !slices.Equal(code, []byte{0, 255, 0}) {
+		t.Errorf("expected clamped code [0 255 0], got %v", code)
+	}
+}
+
+func TestSQ8Distance(t *testing.T) {
+	rng := rand.New(rand.NewSource(20))
+	randomVector := func() []float32 {
+		vector := make([]float32, 16)
+		for i := range vector {
+			vector[i] = rng.Float32()*4 - 2
+		}
+		return vector
+	}
+
+	samples := make([][]float32, 100)
+	for i := range samples {
+		samples[i] = randomVector()
+	}
+
+	// the distance on codes is the distance to the decoded vector, whatever the distance computer does
+	for _, distance := range []DistanceComputer{&L2Distance{}, &L2SquaredDistance{}, &CosineDistance{}, &ManhattanDistance{}} {
+		q := newSQ8Quantizer(16, distance)
+		q.train(samples)
+
+		query := randomVector()
+		queryDistance := q.queryDistance(query)
+		for _, sample := range samples[:10] {
+			code := q.encode(sample)
+			expected := distance.CalcDistance(query, q.decode(code))
+			if got := queryDistance.distance(code); abs(got-expected) > 1e-4 {
+				t.Errorf("%s: expected %v, got %v", distance.GetName(), expected, got)
+			}
+		}
+	}
+}
+
+func TestHNSW_SQ8(t *testing.T) {
+	const dim = 32
+
+	rng := rand.New(rand.NewSource(21))
+	vectors := randomVectors(rng, 2000, dim)
+	queries := randomVectors(rng, 50, dim)
+
+	newIndex := func(rerankFactor int) *HNSW {
+		return NewHNSW(HNSWOption{
+			M:              16,
+			EfConstruction: 100,
+			EfSearch:       50,
+			VectorDim:      dim,
+			Quantization:   QuantizationSQ8,
+			RerankFactor:   rerankFactor,
+
+			RNG: rand.New(rand.NewSource(22)),
+		})
+	}
+
+	h := newIndex(0)
+	if _, err := h.AddVector(vectors[0]); err == nil {
+		t.Fatalf("expected error adding before training")
+	}
+	if err := h.Train(vectors); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := h.AddVectors(vectors, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Train(vectors); err == nil {
+		t.Errorf("expected error training the index with vectors")
+	}
+	if h.vectors != nil {
+		t.Errorf("expected float32 vectors not to be kept without rerank")
+	}
+
+	recall := recallAt(h, vectors, ids, queries, 10)
+	if recall < 0.8 {
+		t.Errorf("expected recall@10 at least 0.8, got %v", recall)
+	}
+
+	reranked := newIndex(3)
+	reranked.Train(vectors)
+	rerankedIDs, _ := reranked.AddVectors(vectors, 0)
+	rerankedRecall := recallAt(reranked, vectors, rerankedIDs, queries, 10)
+	if rerankedRecall < recall || rerankedRecall < 0.9 {
+		t.Errorf("expected rerank to improve recall@10 %v, got %v", recall, rerankedRecall)
+	}
+
+	// reranked distance is exact
+	resultIDs, distances, _ := reranked.Search(queries[0], 1)
+	if expected := reranked.distanceComputerFunc.CalcDistance(queries[0], vectors[slices.Index(rerankedIDs, resultIDs[0])]); distances[0] != expected {
+		t.Errorf("expected exact distance %v after rerank, got %v", expected, distances[0])
+	}
+
+	// the quantizer and the codes are saved, search gives the same result after loading
+	for _, index := range []*HNSW{h, reranked} {
+		path := filepath.Join(t.TempDir(), "index.db")
+		if err := index.SaveToDisk(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadFromDisk(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, query := range queries[:10] {
+			expectedIDs, expectedDistances, _ := index.Search(query, 10)
+			gotIDs, gotDistances, _ := loaded.Search(query, 10)
+			if !slices.Equal(expectedIDs, gotIDs) || !slices.Equal(expectedDistances, gotDistances) {
+				t.Fatalf("rerank %d: search differs after loading\n%v %v\n%v %v", index.rerankFactor, expectedIDs, expectedDistances, gotIDs, gotDistances)
+			}
+		}
+	}
+}
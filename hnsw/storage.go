@@ -0,0 +1,144 @@
+package hnsw
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+const maxSegments = 48
+
+// segmentedSlice is an append only slice addressed by node ID.
+// Segment k holds firstSize << k elements, growing allocates a new segment
+// instead of copying the old ones, so existing elements never move
+// and can be read while another goroutine is appending.
+// append must be serialized by the caller
+type segmentedSlice[T any] struct {
+	firstSize int
+	length    atomic.Int64
+	segments  [maxSegments][]T
+}
+
+func newSegmentedSlice[T any](firstSize int) *segmentedSlice[T] {
+	if firstSize <= 0 {
+		firstSize = defaultSize
+	}
+
+	return &segmentedSlice[T]{firstSize: firstSize}
+}
+
+// locate return the segment and the offset within the segment of idx.
+// segment k starts at firstSize * (2^k - 1)
+func (s *segmentedSlice[T]) locate(idx int) (segment int, offset int) {
+	return locateSegment(s.firstSize, idx)
+}
+
+func locateSegment(firstSize int, idx int) (segment int, offset int) {
+	segment = bits.Len(uint(idx/firstSize+1)) - 1
+	offset = idx - firstSize*((1<<segment)-1)
+	return
+}
+
+func (s *segmentedSlice[T]) len() int {
+	return int(s.length.Load())
+}
+
+func (s *segmentedSlice[T]) get(idx int) T {
+	segment, offset := s.locate(idx)
+	return s.segments[segment][offset]
+}
+
+// set replace existing element
+func (s *segmentedSlice[T]) set(idx int, value T) {
+	segment, offset := s.locate(idx)
+	s.segments[segment][offset] = value
+}
+
+// append add value to the end and return its index.
+// the element is written before the length is published
+func (s *segmentedSlice[T]) append(value T) int {
+	idx := s.len()
+
+	segment, offset := s.locate(idx)
+	if s.segments[segment] == nil {
+		s.segments[segment] = make([]T, s.firstSize<<segment)
+	}
+	s.segments[segment][offset] = value
+
+	s.length.Store(int64(idx + 1))
+
+	return idx
+}
+
+// toSlice copy the elements into a regular slice
+func (s *segmentedSlice[T]) toSlice() []T {
+	length := s.len()
+	result := make([]T, 0, length)
+	for idx := 0; idx < length; idx++ {
+		result = append(result, s.get(idx))
+	}
+	return result
+}
+
+// vectorArena is an append only store of dim long vectors addressed by node ID.
+// It grows by segments like segmentedSlice, but the vectors of a segment are stored back to back
+// in a single array, so there is one allocation per segment instead of one per vector,
+// neighbor vectors are more likely to share cache lines and the GC has no pointer to scan.
+// append must be serialized by the caller
+type vectorArena[T any] struct {
+	firstSize int
+	dim       int
+	length    atomic.Int64
+	segments  [maxSegments][]T
+}
+
+func newVectorArena[T any](firstSize int, dim int) *vectorArena[T] {
+	if firstSize <= 0 {
+		firstSize = defaultSize
+	}
+
+	return &vectorArena[T]{firstSize: firstSize, dim: dim}
+}
+
+func (a *vectorArena[T]) len() int {
+	return int(a.length.Load())
+}
+
+// get return the vector stored in the arena, it must not be modified.
+// The capacity is limited so appending to it doesn't overwrite the next vector
+func (a *vectorArena[T]) get(idx int) []T {
+	segment, offset := locateSegment(a.firstSize, idx)
+	start := offset * a.dim
+	return a.segments[segment][start : start+a.dim : start+a.dim]
+}
+
+// set copy vector over the existing one, no one may read it at the same time
+func (a *vectorArena[T]) set(idx int, vector []T) {
+	copy(a.get(idx), vector)
+}
+
+// append copy vector to the end and return its index.
+// the vector is written before the length is published
+func (a *vectorArena[T]) append(vector []T) int {
+	idx := a.len()
+
+	segment, offset := locateSegment(a.firstSize, idx)
+	if a.segments[segment] == nil {
+		a.segments[segment] = make([]T, (a.firstSize<<segment)*a.dim)
+	}
+	start := offset * a.dim
+	copy(a.segments[segment][start:start+a.dim], vector)
+
+	a.length.Store(int64(idx + 1))
+
+	return idx
+}
+
+// toSlice return every vector, they are views into the arena and must not be modified
+func (a *vectorArena[T]) toSlice() [][]T {
+	length := a.len()
+	result := make([][]T, 0, length)
+	for idx := 0; idx < length; idx++ {
+		result = append(result, a.get(idx))
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package hnsw
+
+import (
+	"flag"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var memorySize = flag.Int("memory-size", 100000, "number of vectors in BenchmarkHNSW_Memory")
+
+func TestSegmentedSlice(t *testing.T) {
+	s := newSegmentedSlice[int](3)
+
+	for i := 0; i < 100; i++ {
+		if idx := s.append(i * 10); idx != i {
+			t.Fatalf("expected index %d, got %d", i, idx)
+		}
+	}
+
+	if s.len() != 100 {
+		t.Errorf("expected len 100, got %d", s.len())
+	}
+
+	s.set(42, 7)
+	for i := 0; i < 100; i++ {
+		expected := i * 10
+		if i == 42 {
+			expected = 7
+		}
+		if s.get(i) != expected {
+			t.Errorf("expected %d at %d, got %d", expected, i, s.get(i))
+		}
+	}
+
+	// segment sizes are 3, 6, 12, ...
+	expected := [][2]int{{0, 0}, {2, 0}, {3, 1}, {8, 1}, {9, 2}, {20, 2}, {21, 3}}
+	for _, e := range expected {
+		segment, _ := s.locate(e[0])
+		if segment != e[1] {
+			t.Errorf("expected index %d in segment %d, got %d", e[0], e[1], segment)
+		}
+	}
+}
+
+func TestVectorArena(t *testing.T) {
+	a := newVectorArena[float32](3, 2)
+
+	for i := 0; i < 100; i++ {
+		vector := []float32{float32(i), float32(-i)}
+		if idx := a.append(vector); idx != i {
+			t.Fatalf("expected index %d, got %d", i, idx)
+		}
+		// the arena keeps a copy
+		vector[0] = 1000
+	}
+
+	if a.len() != 100 {
+		t.Errorf("expected len 100, got %d", a.len())
+	}
+
+	a.set(42, []float32{7, 8})
+	for i, vector := range a.toSlice() {
+		expected := []float32{float32(i), float32(-i)}
+		if i == 42 {
+			expected = []float32{7, 8}
+		}
+		if len(vector) != 2 || vector[0] != expected[0] || vector[1] != expected[1] {
+			t.Errorf("expected %v at %d, got %v", expected, i, vector)
+		}
+	}
+
+	// appending to a vector must not overwrite the next one
+	_ = append(a.get(0), 99)
+	if a.get(1)[0] != 1 {
+		t.Errorf("expected the next vector unchanged, got %v", a.get(1))
+	}
+
+	// one array per segment, sizes are 3, 6, 12, ...
+	if size := len(a.segments[2]); size != 12*2 {
+		t.Errorf("expected segment 2 of %d floats, got %d", 12*2, size)
+	}
+}
+
+// BenchmarkHNSW_Memory report the heap held by the index and the time of a full GC once built,
+// then the search throughput. For the 1M vectors numbers in the README run
+// go test -run none -bench HNSW_Memory -benchtime 30000x ./hnsw -memory-size 1000000
+func BenchmarkHNSW_Memory(b *testing.B) {
+	const dim = 64
+	const batchSize = 10000
+
+	rng := rand.New(rand.NewSource(30))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	h := NewHNSW(HNSWOption{
+		M:                16,
+		EfConstruction:   100,
+		EfSearch:         64,
+		VectorDim:        dim,
+		DistanceComputer: &L2SquaredDistance{},
+
+		RNG: rand.New(rand.NewSource(31)),
+	})
+	// added in batches, so only the index keeps the vectors
+	buildStart := time.Now()
+	for added := 0; added < *memorySize; added += batchSize {
+		if _, err := h.AddVectors(randomVectors(rng, min(batchSize, *memorySize-added), dim), 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+	buildTime := time.Since(buildStart)
+
+	gcStart := time.Now()
+	runtime.GC()
+	gcTime := time.Since(gcStart)
+	runtime.ReadMemStats(&after)
+
+	queries := randomVectors(rng, 1000, dim)
+	b.Run("search", func(b *testing.B) {
+		b.ReportAllocs()
+
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			h.Search(queries[i%len(queries)], 10)
+		}
+		b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "qps")
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "heap-MB")
+		b.ReportMetric(float64(after.HeapObjects-before.HeapObjects), "heap-objects")
+		b.ReportMetric(float64(gcTime.Microseconds())/1000, "gc-ms")
+		b.ReportMetric(buildTime.Seconds(), "build-s")
+	})
+}
@@ -0,0 +1,52 @@
+package hnsw
+
+import "fmt"
+
+// Update replace the vector of an existing node while keeping its ID.
+// The node neighbors are searched again on every level it lives on
+// and the nodes pointing to it rebuild their neighbor list with the new distance
+func (h *GenericHNSW[T]) Update(id int, vector []T) error {
+	if len(vector) != h.vectorDim {
+		return fmt.Errorf("Update : Different vector dimension. Got %d expected %d", len(vector), h.vectorDim)
+	}
+
+	if h.normalizeVector {
+		vector = normalize(vector)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// AddVectors may not have linked the node yet
+	if id < 0 || id >= h.nodes.len() || !h.node(id).linked {
+		return fmt.Errorf("Update : node %d not found", id)
+	}
+
+	node := h.node(id)
+	if node.Deleted {
+		return fmt.Errorf("Update : node %d is deleted", id)
+	}
+
+	if h.vectors != nil {
+		h.vectors.set(id, vector)
+	}
+	if h.codes != nil {
+		h.codes.set(id, h.quantizer.encode(vector))
+	}
+
+	// nodes pointing to the updated node may have better neighbor now
+	h.buildInLinks()
+	for level := 0; level <= node.MaxLevel; level++ {
+		h.repairNeighbors(id, level, false)
+	}
+
+	// the only node in the graph has nothing to connect to
+	if h.nodes.len() == 1 {
+		return nil
+	}
+
+	entryPoint, curMaxLevel := h.getEntryPoint()
+	h.connectNode(node, vector, entryPoint, curMaxLevel)
+
+	return nil
+}
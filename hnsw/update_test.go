@@ -0,0 +1,63 @@
+package hnsw
+
+import "testing"
+
+func TestHNSW_Update(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	id := ids[44] // (4, 4)
+	if err := h.Update(id, []float32{9.5, 9.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _, err := h.Search([]float32{9.5, 9.5}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0] != id {
+		t.Errorf("expected [%d], got %v", id, result)
+	}
+
+	result, _, _ = h.Search([]float32{4, 4}, 1)
+	if len(result) != 1 || result[0] == id {
+		t.Errorf("expected other node than %d, got %v", id, result)
+	}
+
+	// every node still can be found and no node linked to itself or twice
+	for _, node := range h.nodes.toSlice() {
+		result, _, _ := h.Search(h.vector(node.ID), 1)
+		if len(result) != 1 || result[0] != node.ID {
+			t.Errorf("expected to find node %d, got %v", node.ID, result)
+		}
+
+		for level, neighbors := range node.PerLevelNeighbors {
+			seen := map[int]bool{}
+			for _, neighbor := range neighbors {
+				neighborID := int(neighbor)
+				if neighborID == node.ID {
+					t.Errorf("node %d linked to itself on level %d", node.ID, level)
+				}
+				if seen[neighborID] {
+					t.Errorf("node %d linked twice to %d on level %d", node.ID, neighborID, level)
+				}
+				seen[neighborID] = true
+			}
+		}
+	}
+}
+
+func TestHNSW_UpdateError(t *testing.T) {
+	h, ids := newGridHNSW(t)
+
+	if err := h.Update(ids[0], []float32{1, 2, 3}); err == nil {
+		t.Errorf("expected error on different dimension")
+	}
+	if err := h.Update(len(ids), []float32{1, 2}); err == nil {
+		t.Errorf("expected error on unknown node")
+	}
+
+	h.Delete(ids[0])
+	if err := h.Update(ids[0], []float32{1, 2}); err == nil {
+		t.Errorf("expected error on deleted node")
+	}
+}
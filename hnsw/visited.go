@@ -0,0 +1,87 @@
+package hnsw
+
+// visitedSet marks the visited node IDs of a search.
+// Instead of clearing the array between searches, reset bumps the epoch
+// and a node is visited when its stamp equals the current epoch
+type visitedSet struct {
+	stamps []uint32
+	epoch  uint32
+}
+
+// reset forget every visited node and make room for size nodes
+func (v *visitedSet) reset(size int) {
+	if len(v.stamps) < size {
+		v.stamps = make([]uint32, size)
+	}
+
+	v.epoch++
+	// the epoch wrapped, old stamps could collide with the new epoch
+	if v.epoch == 0 {
+		clear(v.stamps)
+		v.epoch = 1
+	}
+}
+
+// visit mark the node as visited and report whether it was visited before.
+// The set grows for node added to the graph after reset
+func (v *visitedSet) visit(id int) bool {
+	if id >= len(v.stamps) {
+		stamps := make([]uint32, max(id+1, 2*len(v.stamps)))
+		copy(stamps, v.stamps)
+		v.stamps = stamps
+	}
+
+	if v.stamps[id] == v.epoch {
+		return true
+	}
+	v.stamps[id] = v.epoch
+
+	return false
+}
+
+// searchBuffer is the scratch memory of a search, it's pooled by HNSW so searching doesn't allocate
+type searchBuffer struct {
+	visited   visitedSet
+	candidate priorityQueue[pqItem] // closest first
+	found     priorityQueue[pqItem] // farthest first
+	result    []pqItem
+
+	// done is closed when the search must stop, nil never stops
+	done <-chan struct{}
+	// interrupted is set once the search stopped because of done
+	interrupted bool
+
+	// stats is filled by the search when not nil, explain record the path into it
+	stats   *SearchStats
+	explain bool
+}
+
+// stopped report whether the search must stop, the nodes found so far are kept
+func (buf *searchBuffer) stopped() bool {
+	select {
+	case <-buf.done:
+		buf.interrupted = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *GenericHNSW[T]) getSearchBuffer() *searchBuffer {
+	if buf, ok := h.searchPool.Get().(*searchBuffer); ok {
+		return buf
+	}
+
+	return &searchBuffer{
+		candidate: newPriorityQueueMin(h.EfSearch),
+		found:     newPriorityQueueMax(h.EfSearch + 1),
+	}
+}
+
+func (h *GenericHNSW[T]) putSearchBuffer(buf *searchBuffer) {
+	buf.done = nil
+	buf.interrupted = false
+	buf.stats = nil
+	buf.explain = false
+	h.searchPool.Put(buf)
+}
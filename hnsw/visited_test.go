@@ -0,0 +1,40 @@
+package hnsw
+
+import "testing"
+
+func TestVisitedSet(t *testing.T) {
+	var v visitedSet
+	v.reset(4)
+
+	if v.visit(1) {
+		t.Errorf("expected 1 not visited")
+	}
+	if !v.visit(1) {
+		t.Errorf("expected 1 visited")
+	}
+
+	// node added after reset
+	if v.visit(10) {
+		t.Errorf("expected 10 not visited")
+	}
+	if !v.visit(10) || !v.visit(1) {
+		t.Errorf("expected 1 and 10 visited after growing")
+	}
+
+	v.reset(4)
+	if v.visit(1) || v.visit(10) {
+		t.Errorf("expected nothing visited after reset")
+	}
+
+	// old stamps must not collide when the epoch wraps
+	v.visit(2)
+	v.epoch = ^uint32(0)
+	v.stamps[3] = 1
+	v.reset(4)
+	if v.epoch != 1 {
+		t.Errorf("expected epoch 1 after wrapping, got %d", v.epoch)
+	}
+	if v.visit(3) {
+		t.Errorf("expected 3 not visited after wrapping")
+	}
+}
@@ -19,10 +19,24 @@ var groundTruth [][]uint32
 const dimension = 128
 
 var flagRebuildIndex *bool
+var flagHeuristic *bool
+var flagWorkers *int
+var flagEf *int
+var flagQuantization *string
+var flagRerank *int
+var flagPQSubquantizers *int
+var flagPQBits *int
 
 func main() {
 	// read args for flagrebuildindex
 	flagRebuildIndex = flag.Bool("rebuild", false, "Rebuild the HNSW index")
+	flagHeuristic = flag.Bool("heuristic", false, "Use heuristic neighbor selection when rebuilding")
+	flagWorkers = flag.Int("workers", 0, "Number of goroutines used when rebuilding, 0 means GOMAXPROCS")
+	flagEf = flag.Int("ef", 300, "EfSearch used by the queries")
+	flagQuantization = flag.String("quantization", "", "Quantization used when rebuilding, sq8, pq, binary, float16, bfloat16 or empty for float32")
+	flagRerank = flag.Int("rerank", 0, "Rerank factor of the quantized index used when rebuilding, 0 means no rerank")
+	flagPQSubquantizers = flag.Int("pq-m", 0, "Number of PQ subquantizers used when rebuilding, 0 means dimension/4")
+	flagPQBits = flag.Int("pq-bits", 0, "Bits of every PQ subquantizer code used when rebuilding, 0 means 8")
 
 	flag.Parse()
 
@@ -85,6 +99,13 @@ func main() {
 		EfSearch:         300,
 		DistanceComputer: &hnsw.L2SquaredDistance{},
 
+		NeighborHeuristic: *flagHeuristic,
+
+		Quantization:    *flagQuantization,
+		RerankFactor:    *flagRerank,
+		PQSubquantizers: *flagPQSubquantizers,
+		PQBits:          *flagPQBits,
+
 		VectorDim: dimension,
 		Size:      len(baseVector),
 	})
@@ -117,19 +138,30 @@ func main() {
 }
 
 func indexBase(vectorData [][]float32, index *hnsw.HNSW) {
-	for _, v := range vectorData {
-		index.AddVector(v)
+	if *flagQuantization != hnsw.QuantizationNone {
+		err := index.Train(vectorData)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// IDs follow the order of vectorData, so they match the ground truth
+	_, err := index.AddVectors(vectorData, *flagWorkers)
+	if err != nil {
+		panic(err)
 	}
 }
 
 func searchQuery(vectorData [][]float32, index *hnsw.HNSW, topK int) (results map[int][]int) {
 	results = make(map[int][]int)
 	for i, v := range vectorData {
-		result, _, err := index.Search(v, topK)
+		result, err := index.SearchWithOptions(v, hnsw.SearchOptions{TopK: topK, EfSearch: *flagEf})
 		if err != nil {
 			panic(err)
 		}
-		results[i] = result
+		for _, res := range result {
+			results[i] = append(results[i], res.ID)
+		}
 	}
 	return results
 }